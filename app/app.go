@@ -196,7 +196,8 @@ func (app *App) DB(env string, debug bool) *bun.DB {
 			panic(err)
 		}
 
-		app.OnStop("db.Close", func(ctx context.Context, _ *App) error {
+		// after the OnStop hooks, which may still write
+		app.OnAfterStop("db.Close", func(ctx context.Context, _ *App) error {
 			return db.Close()
 		})
 
@@ -2,6 +2,7 @@ package authorization
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"strings"
@@ -16,8 +17,6 @@ import (
 	uuid "github.com/google/uuid"
 	"github.com/resonatecoop/user-api-template/model"
 	"github.com/resonatecoop/user-api-template/pkg/access"
-	uuidpkg "github.com/resonatecoop/user-api-template/pkg/uuid"
-	pbUser "github.com/resonatecoop/user-api-template/proto/user"
 	grpclog "google.golang.org/grpc/grpclog"
 )
 
@@ -29,9 +28,11 @@ var (
 )
 
 type AuthInterceptor struct {
-	db  *bun.DB
-	rf  int
-	acc *access.AccessConfig
+	db      *bun.DB
+	refresh *RefreshExtender
+	acc     *access.AccessConfig
+	cache   *Cache
+	jwt     *JWTVerifier
 }
 
 func stringInSlice(a string, list []string) bool {
@@ -43,8 +44,12 @@ func stringInSlice(a string, list []string) bool {
 	return false
 }
 
-func NewAuthInterceptor(db *bun.DB, rf int, acc *access.AccessConfig) *AuthInterceptor {
-	return &AuthInterceptor{db, rf, acc}
+// NewAuthInterceptor returns an AuthInterceptor looking tokens and users up
+// in db through cache, which may be nil, and extending refresh tokens through
+// refresh. JWT access tokens are verified by jwt, or not accepted when it's
+// nil.
+func NewAuthInterceptor(db *bun.DB, refresh *RefreshExtender, acc *access.AccessConfig, cache *Cache, jwt *JWTVerifier) *AuthInterceptor {
+	return &AuthInterceptor{db, refresh, acc, cache, jwt}
 }
 
 func (interceptor *AuthInterceptor) Unary() grpc.UnaryServerInterceptor {
@@ -89,7 +94,7 @@ func (interceptor *AuthInterceptor) Unary() grpc.UnaryServerInterceptor {
 		//	eg if requesting token
 		if TokenRequired {
 			grpclog.Infof("Expecting AccessToken, let's check ...")
-			err := interceptor.authorize(ctx, req, info.FullMethod)
+			authUser, err := interceptor.authorize(ctx, req, info.FullMethod)
 			if err != nil {
 				grpclog.Infof("Request Denied - Method:%s\tDuration:%s\tError:%v\n",
 					info.FullMethod,
@@ -97,6 +102,21 @@ func (interceptor *AuthInterceptor) Unary() grpc.UnaryServerInterceptor {
 					err)
 				return nil, err
 			}
+
+			ctx = ContextWithAuthUser(ctx, authUser)
+		} else if md, ok := metadata.FromIncomingContext(ctx); ok && len(md["authorization"]) > 0 {
+			// methods that need no token still act for the requestor when
+			// one is sent, eg AddUser holds them to the role policy
+			authUser, err := interceptor.authenticate(ctx, md["authorization"][0], info.FullMethod)
+			if err != nil {
+				grpclog.Infof("Request Denied - Method:%s\tDuration:%s\tError:%v\n",
+					info.FullMethod,
+					time.Since(start),
+					err)
+				return nil, err
+			}
+
+			ctx = ContextWithAuthUser(ctx, authUser)
 		}
 
 		// Calls the handler
@@ -111,79 +131,133 @@ func (interceptor *AuthInterceptor) Unary() grpc.UnaryServerInterceptor {
 	}
 }
 
-func (interceptor *AuthInterceptor) authorize(ctx context.Context, req interface{}, method string) error {
+// authorize checks the access token of a request allows calling method and
+// returns the user it was issued to, with the lesser of their role and the
+// token's
+func (interceptor *AuthInterceptor) authorize(ctx context.Context, req interface{}, method string) (*model.AuthUser, error) {
 
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
-		return status.Errorf(codes.Unauthenticated, "metadata is not provided")
+		return nil, status.Errorf(codes.Unauthenticated, "metadata is not provided")
 	}
 
 	values := md["authorization"]
 	if len(values) == 0 {
-		return status.Errorf(codes.Unauthenticated, "authorization token is not provided")
+		return nil, status.Errorf(codes.Unauthenticated, "authorization token is not provided")
 	}
 
 	PublicMethods := strings.Split(interceptor.acc.PublicMethods, ",")
-	WriteMethods := strings.Split(interceptor.acc.WriteMethods, ",")
+	AdminMethods := strings.Split(interceptor.acc.AdminMethods, ",")
 
 	isPublicAccessMethod := stringInSlice(method, PublicMethods)
 
-	accessTokenSource := strings.Split(values[0], " ")
+	authUser, err := interceptor.authenticate(ctx, values[0], method)
+	if err != nil {
+		return nil, err
+	}
+
+	activeRole := int32(authUser.Role)
+
+	// everyone can access public methods, handlers check through the RBAC
+	// service that requestors only act on their own records
+	if isPublicAccessMethod {
+		return authUser, nil
+	}
+
+	// If not an admin, you can't access the remaining non-public methods
+	if activeRole > int32(model.TenantAdminRole) {
+		return nil, status.Errorf(codes.PermissionDenied, "requestor is not authorized for this method")
+	}
+
+	// Tenant admins can't access methods reserved to admins
+	if stringInSlice(method, AdminMethods) && activeRole > int32(model.AdminRole) {
+		return nil, status.Errorf(codes.PermissionDenied, "requestor is not authorized for this method")
+	}
+
+	// else all is fine at this gate at least, go ahead; tenant admins are
+	// held to their own tenant by the handlers
+	return authUser, nil
+}
+
+// authenticate checks the access token of an authorization header allows
+// calling method and returns the user it was issued to, without the gates
+// authorize applies
+func (interceptor *AuthInterceptor) authenticate(ctx context.Context, header string, method string) (*model.AuthUser, error) {
+	accessTokenSource := strings.Split(header, " ")
 
 	if len(accessTokenSource) != 2 {
-		return status.Errorf(codes.PermissionDenied, "incorrect authorization header format")
+		return nil, status.Errorf(codes.PermissionDenied, "incorrect authorization header format")
 	}
 
 	accessToken := accessTokenSource[1]
 
+	if interceptor.jwt != nil && isJWT(accessToken) {
+		return interceptor.authorizeJWT(ctx, accessToken, method)
+	}
+
+	return interceptor.authorizeOpaque(ctx, accessToken, method)
+}
+
+// authorizeOpaque looks an opaque access token up and checks it allows
+// calling method, returning the user it was issued to with the lesser of
+// their role and the token's
+func (interceptor *AuthInterceptor) authorizeOpaque(ctx context.Context, accessToken string, method string) (*model.AuthUser, error) {
 	accessTokenRecord, err := interceptor.Authenticate(accessToken)
 	if err != nil {
-		return status.Errorf(codes.Unauthenticated, "access token is invalid: %v", err)
+		return nil, status.Errorf(codes.Unauthenticated, "access token is invalid: %v", err)
 	}
 
-	scopes := strings.Split(accessTokenRecord.Scope, " ")
+	scopes := strings.Fields(accessTokenRecord.Scope)
 
-	// determine if the request has write permission
-	_, read_write := interceptor.find(scopes, "read_write")
-
-	// leave now if no write permission
-	if !read_write && stringInSlice(method, WriteMethods) {
-		return status.Errorf(codes.PermissionDenied, "attempt to write to user-api without write scope")
+	// leave now if the token doesn't grant the permission the method needs
+	if err = checkScope(scopes, method); err != nil {
+		return nil, err
 	}
 
-	scopes = interceptor.delete(scopes, "read_write")
+	// the role claim of the token, or for legacy tokens the least privileged
+	// role named in its scopes; tokens without either have the user's role
+	var roleNames []string
 
-	scopes = interceptor.delete(scopes, "read")
+	if accessTokenRecord.Role != "" {
+		roleNames = []string{accessTokenRecord.Role}
+	} else {
+		roleNames = roleScopes(scopes)
+	}
 
-	// assume role is remaining scope element
-	tokenRole := scopes[0]
+	return interceptor.authUser(ctx, accessTokenRecord.UserID, roleNames)
+}
 
-	tokenRoleRow := new(model.Role)
+// authUser looks up the user a token was issued to and returns them with the
+// lesser of their role and the least privileged of the roles the token names,
+// or their own role when it names none that exists
+func (interceptor *AuthInterceptor) authUser(ctx context.Context, userID uuid.UUID, roleNames []string) (*model.AuthUser, error) {
+	var tokenRoleValue int32
+	var err error
 
-	err = interceptor.db.NewSelect().
-		Model(tokenRoleRow).
-		Where("name = ?", tokenRole).
-		Scan(ctx)
+	if len(roleNames) > 0 {
+		tokenRoleValue, err = interceptor.roleID(ctx, roleNames)
 
-	if err != nil {
-		return status.Errorf(codes.PermissionDenied, "problem determining role from token")
+		if err != nil {
+			return nil, status.Errorf(codes.PermissionDenied, "problem determining role from token")
+		}
 	}
 
-	tokenRoleValue := tokenRoleRow.ID
-
-	user := new(model.User)
-
-	err = interceptor.db.NewSelect().
-		Model(user).
-		Where("id = ?", accessTokenRecord.UserID).
-		Scan(ctx)
+	user, err := interceptor.user(ctx, userID)
 
 	if err != nil {
-		return status.Errorf(codes.PermissionDenied, "problem determining user role")
+		return nil, err
+	}
+
+	if user.TenantInactive {
+		return nil, status.Errorf(codes.PermissionDenied, "tenant of requestor is inactive")
 	}
 
 	userRoleValue := user.RoleID
 
+	if tokenRoleValue == 0 {
+		tokenRoleValue = userRoleValue
+	}
+
 	var activeRole int32
 
 	if userRoleValue > tokenRoleValue {
@@ -192,155 +266,156 @@ func (interceptor *AuthInterceptor) authorize(ctx context.Context, req interface
 		activeRole = tokenRoleValue
 	}
 
-	if isPublicAccessMethod {
-		// everyone can access but check it's against their own ID
-		if activeRole > int32(model.LabelRole) {
-			id, err := interceptor.extractUserIdFromReq(ctx, req, accessTokenRecord)
+	return &model.AuthUser{
+		ID:       user.ID,
+		TenantID: user.TenantID,
+		Username: user.Username,
+		Email:    user.Username,
+		Role:     model.AccessRole(activeRole),
+	}, nil
+}
 
-			if err != nil {
-				return err
-			}
+// authorizeJWT verifies a JWT access token and checks it allows calling
+// method, returning the user of its subject like authorizeOpaque does
+func (interceptor *AuthInterceptor) authorizeJWT(ctx context.Context, accessToken string, method string) (*model.AuthUser, error) {
+	claims, err := interceptor.jwt.Verify(accessToken)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "access token is invalid: %v", err)
+	}
 
-			ID, err := uuid.Parse(id)
+	scopes := strings.Fields(claims.Scope)
 
-			if err != nil {
-				return status.Errorf(codes.PermissionDenied, "UUID in request is not valid")
-			}
+	if err = checkScope(scopes, method); err != nil {
+		return nil, err
+	}
 
-			if ID != user.ID {
-				return status.Errorf(codes.PermissionDenied, "requestor is not authorized to take action on another user record")
-			}
-			// must be working on their own record
-		}
-		return nil
+	roleNames := roleScopes(scopes)
+
+	if claims.Role != "" {
+		roleNames = []string{claims.Role}
 	}
 
-	// If not an admin, you can't access the remaining non-public methods
-	if activeRole > int32(model.TenantAdminRole) {
-		return status.Errorf(codes.PermissionDenied, "requestor is not authorized for this method")
+	return interceptor.authUser(ctx, uuid.MustParse(claims.Subject), roleNames)
+}
+
+// checkScope checks the scopes of a token grant the permission method needs
+func checkScope(scopes []string, method string) error {
+	requiredScope, ok := MethodScopes[method]
+	if !ok {
+		return status.Errorf(codes.PermissionDenied, "no permission scope is defined for method %s", method)
+	}
+
+	if !GrantedScopes(scopes)[requiredScope] {
+		return status.Errorf(codes.PermissionDenied, "access token is missing scope %s required by method %s", requiredScope, method)
 	}
 
-	// else all is fine at this gate at least, go ahead
 	return nil
 }
 
-// Authenticate checks the access token is valid
-func (interceptor *AuthInterceptor) Authenticate(token string) (*model.AccessToken, error) {
-	// Fetch the access token from the database
-	ctx := context.Background()
-	accessToken := new(model.AccessToken)
+// roleID returns the id of the least privileged of the roles named, or 0
+// when none of the names is a role, eg the openid scope of an OIDC token
+func (interceptor *AuthInterceptor) roleID(ctx context.Context, names []string) (int32, error) {
+	key := strings.Join(names, " ")
+
+	if id, ok := interceptor.cache.role(key); ok {
+		return id, nil
+	}
+
+	role := new(model.Role)
 
 	err := interceptor.db.NewSelect().
-		Model(accessToken).
-		Where("token = ?", token).
+		Model(role).
+		Where("name IN (?)", bun.In(names)).
+		OrderExpr("id DESC").
 		Limit(1).
 		Scan(ctx)
 
-	// Not found
-	if err != nil {
-		return nil, ErrAccessTokenNotFound
-	}
-
-	// Check the access token hasn't expired
-	if time.Now().UTC().After(accessToken.ExpiresAt) {
-		return nil, ErrAccessTokenExpired
+	if errors.Is(err, sql.ErrNoRows) {
+		role.ID = 0
+	} else if err != nil {
+		return 0, err
 	}
 
-	// Extend refresh token expiration database
+	interceptor.cache.putRole(key, role.ID)
 
-	increasedExpiresAt := time.Now().Add(
-		time.Duration(interceptor.rf) * time.Second,
-	)
+	return role.ID, nil
+}
 
-	//var res sql.Result
+// user returns the role and tenant of the user a token was issued to
+func (interceptor *AuthInterceptor) user(ctx context.Context, id uuid.UUID) (*cachedUser, error) {
+	if cached, ok := interceptor.cache.user(id); ok {
+		return cached, nil
+	}
 
-	//	err = GetOrCreateRefreshToken
+	user := new(model.User)
 
-	if uuidpkg.IsValidUUID(accessToken.UserID.String()) && accessToken.UserID != uuid.Nil {
-		_, err = interceptor.db.NewUpdate().
-			Model(new(model.RefreshToken)).
-			Set("expires_at = ?", increasedExpiresAt).
-			Set("updated_at = ?", time.Now().UTC()).
-			Where("client_id = ?", accessToken.ClientID.String()).
-			Where("user_id = ?", accessToken.UserID.String()).
-			Exec(ctx)
-	} else {
-		_, err = interceptor.db.NewUpdate().
-			Model(new(model.RefreshToken)).
-			Set("expires_at = ?", increasedExpiresAt).
-			Set("updated_at = ?", time.Now().UTC()).
-			Where("client_id = ?", accessToken.ClientID.String()).
-			Where("user_id = uuid_nil()").
-			Exec(ctx)
-	}
+	err := interceptor.db.NewSelect().
+		Model(user).
+		Where("id = ?", id).
+		Scan(ctx)
 
 	if err != nil {
-		return nil, err
+		return nil, status.Errorf(codes.PermissionDenied, "problem determining user role")
 	}
 
-	return accessToken, nil
-}
-
-func (interceptor *AuthInterceptor) extractUserIdFromReq(ctx context.Context, req interface{}, accessTokenRecord *model.AccessToken) (string, error) {
-	// Dealing with normal users, Label admins can maintain own artist content.
-	// attempt to extract the Id from all the possible request types dealing with failure
-	userReq, ok := req.(*pbUser.UserRequest)
-
-	if ok {
-		return userReq.Id, nil
+	cached := &cachedUser{
+		ID:       user.ID,
+		TenantID: user.TenantID,
+		Username: user.Username,
+		RoleID:   user.RoleID,
 	}
 
-	userUpdateReq, ok := req.(*pbUser.UserUpdateRequest)
+	if user.TenantID != 0 {
+		cached.TenantInactive, err = interceptor.db.NewSelect().
+			Model((*model.Tenant)(nil)).
+			Where("id = ?", user.TenantID).
+			Where("NOT active").
+			Exists(ctx)
 
-	if ok {
-		return userUpdateReq.Id, nil
+		if err != nil {
+			return nil, status.Errorf(codes.PermissionDenied, "problem determining user tenant")
+		}
 	}
 
-	userGroupCreateReq, ok := req.(*pbUser.UserGroupCreateRequest)
+	interceptor.cache.putUser(cached)
 
-	if ok {
-		return userGroupCreateReq.Id, nil
-	}
+	return cached, nil
+}
+
+// Authenticate checks the access token is valid
+func (interceptor *AuthInterceptor) Authenticate(token string) (*model.AccessToken, error) {
+	// Fetch the access token from the database
+	ctx := context.Background()
 
-	userGroupUpdateReq, ok := req.(*pbUser.UserGroupUpdateRequest)
+	accessToken, cached := interceptor.cache.token(token)
 
-	if ok {
-		newUserGroup := new(model.UserGroup)
+	if !cached {
+		accessToken = new(model.AccessToken)
 
 		err := interceptor.db.NewSelect().
-			Model(newUserGroup).
-			Where("owner_id = ?", accessTokenRecord.UserID).
-			Where("id = ?", userGroupUpdateReq.Id).
+			Model(accessToken).
+			Where("token = ?", token).
+			Limit(1).
 			Scan(ctx)
 
+		// Not found
 		if err != nil {
-			return "", status.Errorf(codes.PermissionDenied, "Supplied UUID for User Group is not valid or logged in User doesn't own Group")
+			return nil, ErrAccessTokenNotFound
 		}
-
-		return accessTokenRecord.UserID.String(), nil
 	}
 
-	return "", status.Errorf(codes.PermissionDenied, "UUID in request is not valid")
-}
-
-func (interceptor *AuthInterceptor) find(slice []string, val string) (int, bool) {
-	for i, item := range slice {
-		if item == val {
-			return i, true
-		}
+	// Check the access token hasn't expired
+	if time.Now().UTC().After(accessToken.ExpiresAt) {
+		return nil, ErrAccessTokenExpired
 	}
-	return -1, false
-}
-
-func (interceptor *AuthInterceptor) delete(slice []string, val string) []string {
-	var location int
 
-	for i, item := range slice {
-		if item == val {
-			location = i
-			slice = append(slice[:location], slice[location+1:]...)
-		}
+	if !cached {
+		interceptor.cache.putToken(accessToken)
 	}
 
-	return slice
+	// Extend refresh token expiration in the background, tokens issued to
+	// the client itself have a nil user id
+	interceptor.refresh.Extend(accessToken.ClientID, accessToken.UserID)
+
+	return accessToken, nil
 }
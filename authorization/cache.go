@@ -0,0 +1,354 @@
+package authorization
+
+import (
+	"container/list"
+	"context"
+	"expvar"
+	"sync"
+	"time"
+
+	uuid "github.com/google/uuid"
+	grpclog "google.golang.org/grpc/grpclog"
+
+	"github.com/resonatecoop/user-api-template/model"
+)
+
+// DefaultCacheSize is how many entries each part of a Cache holds when no
+// size is configured
+const DefaultCacheSize = 10000
+
+// DefaultCacheStatsInterval is how often LogStats logs the cache's hit rates
+// when no interval is configured
+const DefaultCacheStatsInterval = 5 * time.Minute
+
+// cacheMetrics publishes the hits, misses and hit rate of each part of the
+// Cache under auth_cache in expvar
+var cacheMetrics = expvar.NewMap("auth_cache")
+
+// cachedUser is what AuthInterceptor needs to know of the user a token was
+// issued to
+type cachedUser struct {
+	ID             uuid.UUID
+	TenantID       int32
+	Username       string
+	RoleID         int32
+	TenantInactive bool
+}
+
+type cacheEntry struct {
+	key       string
+	value     interface{}
+	expiresAt time.Time
+}
+
+// cacheBucket is a bounded map whose entries expire, evicting the least
+// recently used entry when full and counting its hits and misses
+type cacheBucket struct {
+	name    string
+	size    int
+	entries map[string]*list.Element
+	// lru orders entries from the most to the least recently used
+	lru    *list.List
+	hits   expvar.Int
+	misses expvar.Int
+}
+
+func newCacheBucket(name string, size int) *cacheBucket {
+	b := &cacheBucket{name: name, size: size, entries: make(map[string]*list.Element), lru: list.New()}
+
+	cacheMetrics.Set(name+"_hits", &b.hits)
+	cacheMetrics.Set(name+"_misses", &b.misses)
+	cacheMetrics.Set(name+"_hit_rate", expvar.Func(func() interface{} {
+		return b.hitRate()
+	}))
+
+	return b
+}
+
+func (b *cacheBucket) get(key string, now time.Time) (interface{}, bool) {
+	element, ok := b.entries[key]
+
+	if ok && now.After(element.Value.(*cacheEntry).expiresAt) {
+		b.remove(element)
+		ok = false
+	}
+
+	if !ok {
+		b.misses.Add(1)
+		return nil, false
+	}
+
+	b.hits.Add(1)
+	b.lru.MoveToFront(element)
+
+	return element.Value.(*cacheEntry).value, true
+}
+
+// put stores value under key, evicting the least recently used entry when
+// the bucket is full
+func (b *cacheBucket) put(key string, value interface{}, expiresAt time.Time) {
+	if element, ok := b.entries[key]; ok {
+		entry := element.Value.(*cacheEntry)
+		entry.value, entry.expiresAt = value, expiresAt
+		b.lru.MoveToFront(element)
+		return
+	}
+
+	if b.lru.Len() >= b.size {
+		b.remove(b.lru.Back())
+	}
+
+	b.entries[key] = b.lru.PushFront(&cacheEntry{key: key, value: value, expiresAt: expiresAt})
+}
+
+func (b *cacheBucket) delete(key string) {
+	if element, ok := b.entries[key]; ok {
+		b.remove(element)
+	}
+}
+
+// removeIf drops the entries whose value matches
+func (b *cacheBucket) removeIf(match func(value interface{}) bool) {
+	for element := b.lru.Front(); element != nil; {
+		next := element.Next()
+
+		if match(element.Value.(*cacheEntry).value) {
+			b.remove(element)
+		}
+
+		element = next
+	}
+}
+
+func (b *cacheBucket) remove(element *list.Element) {
+	b.lru.Remove(element)
+	delete(b.entries, element.Value.(*cacheEntry).key)
+}
+
+func (b *cacheBucket) hitRate() float64 {
+	hits, misses := b.hits.Value(), b.misses.Value()
+
+	if hits+misses == 0 {
+		return 0
+	}
+
+	return float64(hits) / float64(hits+misses)
+}
+
+// CacheStats counts the lookups of one part of a Cache
+type CacheStats struct {
+	Hits    int64
+	Misses  int64
+	HitRate float64
+}
+
+// Cache keeps validated access tokens, roles and the role and tenant of users
+// in memory for a while, sparing AuthInterceptor its queries on every call.
+// Handlers changing roles, tenants or tokens invalidate what they change,
+// other processes sharing the database are only caught up by the TTL.
+// A nil *Cache caches nothing.
+type Cache struct {
+	ttl    time.Duration
+	mu     sync.Mutex
+	tokens *cacheBucket
+	roles  *cacheBucket
+	users  *cacheBucket
+}
+
+// NewCache returns a Cache keeping entries for ttl, at most size of each
+// kind, or nil when ttl isn't positive
+func NewCache(ttl time.Duration, size int) *Cache {
+	if ttl <= 0 {
+		return nil
+	}
+
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+
+	return &Cache{
+		ttl:    ttl,
+		tokens: newCacheBucket("tokens", size),
+		roles:  newCacheBucket("roles", size),
+		users:  newCacheBucket("users", size),
+	}
+}
+
+// Stats returns the hits, misses and hit rate of the tokens, roles and users
+// parts of the cache
+func (c *Cache) Stats() map[string]CacheStats {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := make(map[string]CacheStats, 3)
+
+	for _, b := range []*cacheBucket{c.tokens, c.roles, c.users} {
+		stats[b.name] = CacheStats{Hits: b.hits.Value(), Misses: b.misses.Value(), HitRate: b.hitRate()}
+	}
+
+	return stats
+}
+
+// LogStats logs the hits, misses and hit rate of each part of the cache once
+// per interval until ctx is cancelled
+func (c *Cache) LogStats(ctx context.Context, interval time.Duration) {
+	if c == nil {
+		return
+	}
+
+	if interval <= 0 {
+		interval = DefaultCacheStatsInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stats := c.Stats()
+
+		for _, name := range []string{"tokens", "roles", "users"} {
+			grpclog.Infof("[user-api-auth] cache %s: %d hits, %d misses, hit rate %.2f",
+				name, stats[name].Hits, stats[name].Misses, stats[name].HitRate)
+		}
+	}
+}
+
+func (c *Cache) token(token string) (*model.AccessToken, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, ok := c.tokens.get(token, time.Now())
+
+	if !ok {
+		return nil, false
+	}
+
+	return value.(*model.AccessToken), true
+}
+
+// putToken caches a valid access token until the TTL or the token expires,
+// whichever comes first
+func (c *Cache) putToken(accessToken *model.AccessToken) {
+	if c == nil {
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(c.ttl)
+
+	if accessToken.ExpiresAt.Before(expiresAt) {
+		expiresAt = accessToken.ExpiresAt
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.tokens.put(accessToken.Token, accessToken, expiresAt)
+}
+
+func (c *Cache) role(names string) (int32, bool) {
+	if c == nil {
+		return 0, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, ok := c.roles.get(names, time.Now())
+
+	if !ok {
+		return 0, false
+	}
+
+	return value.(int32), true
+}
+
+func (c *Cache) putRole(names string, id int32) {
+	if c == nil {
+		return
+	}
+
+	expiresAt := time.Now().Add(c.ttl)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.roles.put(names, id, expiresAt)
+}
+
+func (c *Cache) user(id uuid.UUID) (*cachedUser, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, ok := c.users.get(id.String(), time.Now())
+
+	if !ok {
+		return nil, false
+	}
+
+	return value.(*cachedUser), true
+}
+
+func (c *Cache) putUser(user *cachedUser) {
+	if c == nil {
+		return
+	}
+
+	expiresAt := time.Now().Add(c.ttl)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.users.put(user.ID.String(), user, expiresAt)
+}
+
+// InvalidateUser drops the role and tenant of user id and their access
+// tokens, for when their role or tenant changes, their tokens are revoked or
+// they are deleted
+func (c *Cache) InvalidateUser(id uuid.UUID) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.users.delete(id.String())
+
+	c.tokens.removeIf(func(value interface{}) bool {
+		return value.(*model.AccessToken).UserID == id
+	})
+}
+
+// InvalidateTenant drops the users of tenant id, for when it's activated or
+// deactivated
+func (c *Cache) InvalidateTenant(id int32) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.users.removeIf(func(value interface{}) bool {
+		return value.(*cachedUser).TenantID == id
+	})
+}
@@ -0,0 +1,107 @@
+package authorization
+
+import (
+	"testing"
+	"time"
+
+	uuid "github.com/google/uuid"
+	"github.com/resonatecoop/user-api-template/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNilCache(t *testing.T) {
+	var c *Cache
+
+	assert.Nil(t, NewCache(0, 10))
+
+	c.putToken(&model.AccessToken{Token: "token", ExpiresAt: time.Now().Add(time.Hour)})
+	_, ok := c.token("token")
+	assert.False(t, ok)
+
+	c.InvalidateUser(uuid.New())
+	c.InvalidateTenant(1)
+	assert.Nil(t, c.Stats())
+}
+
+func TestCacheTokens(t *testing.T) {
+	c := NewCache(time.Minute, 10)
+
+	userID := uuid.New()
+
+	c.putToken(&model.AccessToken{Token: "valid", UserID: userID, ExpiresAt: time.Now().Add(time.Hour)})
+	c.putToken(&model.AccessToken{Token: "expiring", UserID: userID, ExpiresAt: time.Now().Add(-time.Second)})
+
+	token, ok := c.token("valid")
+	if assert.True(t, ok) {
+		assert.Equal(t, userID, token.UserID)
+	}
+
+	// tokens are never cached past their own expiry
+	_, ok = c.token("expiring")
+	assert.False(t, ok)
+
+	c.putUser(&cachedUser{ID: userID, TenantID: 2, RoleID: int32(model.UserRole)})
+
+	c.InvalidateUser(userID)
+
+	_, ok = c.token("valid")
+	assert.False(t, ok)
+	_, ok = c.user(userID)
+	assert.False(t, ok)
+
+	stats := c.Stats()
+	assert.Equal(t, int64(1), stats["tokens"].Hits)
+	assert.Equal(t, int64(2), stats["tokens"].Misses)
+	assert.InDelta(t, 1.0/3, stats["tokens"].HitRate, 0.001)
+}
+
+func TestCacheTenants(t *testing.T) {
+	c := NewCache(time.Minute, 10)
+
+	inTenant, otherTenant := uuid.New(), uuid.New()
+
+	c.putUser(&cachedUser{ID: inTenant, TenantID: 2})
+	c.putUser(&cachedUser{ID: otherTenant, TenantID: 3})
+
+	c.InvalidateTenant(2)
+
+	_, ok := c.user(inTenant)
+	assert.False(t, ok)
+	_, ok = c.user(otherTenant)
+	assert.True(t, ok)
+}
+
+func TestCacheBounded(t *testing.T) {
+	c := NewCache(time.Minute, 2)
+
+	c.putRole("user", int32(model.UserRole))
+	c.putRole("artist", int32(model.ArtistRole))
+	c.putRole("label", int32(model.LabelRole))
+
+	assert.Len(t, c.roles.entries, 2)
+
+	id, ok := c.role("label")
+	assert.True(t, ok)
+	assert.Equal(t, int32(model.LabelRole), id)
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewCache(time.Minute, 2)
+
+	c.putRole("user", int32(model.UserRole))
+	c.putRole("artist", int32(model.ArtistRole))
+
+	// reading user makes artist the least recently used
+	_, ok := c.role("user")
+	assert.True(t, ok)
+
+	c.putRole("label", int32(model.LabelRole))
+
+	_, ok = c.role("artist")
+	assert.False(t, ok)
+	_, ok = c.role("user")
+	assert.True(t, ok)
+	_, ok = c.role("label")
+	assert.True(t, ok)
+	assert.Equal(t, 2, c.roles.lru.Len())
+}
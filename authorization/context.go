@@ -0,0 +1,21 @@
+package authorization
+
+import (
+	"context"
+
+	"github.com/resonatecoop/user-api-template/model"
+)
+
+type authUserCtxKey struct{}
+
+// AuthUserFromContext returns the user a request was authenticated as, or
+// nil for requests that didn't need a token and for internal calls
+func AuthUserFromContext(ctx context.Context) *model.AuthUser {
+	authUser, _ := ctx.Value(authUserCtxKey{}).(*model.AuthUser)
+	return authUser
+}
+
+// ContextWithAuthUser returns a copy of ctx carrying authUser
+func ContextWithAuthUser(ctx context.Context, authUser *model.AuthUser) context.Context {
+	return context.WithValue(ctx, authUserCtxKey{}, authUser)
+}
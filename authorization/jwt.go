@@ -0,0 +1,326 @@
+package authorization
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"time"
+
+	jwt "github.com/form3tech-oss/jwt-go"
+	uuid "github.com/google/uuid"
+)
+
+var (
+	// ErrJWTKeyNotFound is returned for tokens signed with a key we don't have
+	ErrJWTKeyNotFound = errors.New("JWT signing key not found")
+	// ErrJWTAlgorithm is returned for tokens signed otherwise than with RS256
+	// or EdDSA, or with a key of the wrong type
+	ErrJWTAlgorithm = errors.New("JWT signing algorithm not allowed")
+)
+
+// signingMethodEdDSA signs and verifies JWTs with Ed25519 keys, which jwt-go
+// doesn't support
+type signingMethodEdDSA struct{}
+
+// SigningMethodEdDSA is the EdDSA signing method, alg EdDSA
+var SigningMethodEdDSA jwt.SigningMethod = signingMethodEdDSA{}
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+func (signingMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+func (signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(publicKey, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+
+	return nil
+}
+
+func (signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+
+	return jwt.EncodeSegment(ed25519.Sign(privateKey, []byte(signingString))), nil
+}
+
+// audience is the aud claim, a string or an array of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var multiple []string
+
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+
+	*a = multiple
+
+	return nil
+}
+
+// AccessClaims are the claims of JWT access tokens: the user in sub, their
+// email, role and tenant, and the space separated scopes the token grants
+type AccessClaims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Email     string   `json:"email,omitempty"`
+	Scope     string   `json:"scope"`
+	Role      string   `json:"role,omitempty"`
+	TenantID  int32    `json:"tenant_id,omitempty"`
+}
+
+// Valid checks the token has an expiry, has not expired and is already valid
+func (c *AccessClaims) Valid() error {
+	now := time.Now().Unix()
+
+	if c.ExpiresAt == 0 {
+		return errors.New("token has no expiry")
+	}
+
+	if now >= c.ExpiresAt {
+		return ErrAccessTokenExpired
+	}
+
+	if c.NotBefore != 0 && now < c.NotBefore {
+		return errors.New("token is not valid yet")
+	}
+
+	if c.IssuedAt != 0 && now < c.IssuedAt {
+		return errors.New("token used before issued")
+	}
+
+	return nil
+}
+
+// JWTVerifier verifies JWT access tokens signed with RS256 or EdDSA against a
+// set of public keys, looked up by the kid header of tokens
+type JWTVerifier struct {
+	keys     map[string]crypto.PublicKey
+	issuer   string
+	audience string
+}
+
+// NewJWTVerifier loads the public keys of a JWKS file and of a key ring, a
+// directory of PEM public keys named after their kid (<kid>.pem). Tokens
+// must be issued by issuer and for audience, when they aren't empty. It
+// returns nil when neither a JWKS file nor a key ring is configured.
+func NewJWTVerifier(jwksFile string, keyRingDir string, issuer string, audience string) (*JWTVerifier, error) {
+	if jwksFile == "" && keyRingDir == "" {
+		return nil, nil
+	}
+
+	v := &JWTVerifier{keys: make(map[string]crypto.PublicKey), issuer: issuer, audience: audience}
+
+	if jwksFile != "" {
+		if err := v.loadJWKS(jwksFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if keyRingDir != "" {
+		if err := v.loadKeyRing(keyRingDir); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(v.keys) == 0 {
+		return nil, errors.New("no RSA or Ed25519 public keys found for JWT access tokens")
+	}
+
+	return v, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+}
+
+func (v *JWTVerifier) loadJWKS(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading JWKS file, %s", err)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	if err = json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("unable to decode JWKS file, %v", err)
+	}
+
+	for _, key := range set.Keys {
+		// other key types and encryption keys can't verify access tokens
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		switch {
+		case key.Kty == "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(key.N)
+			if err != nil {
+				return fmt.Errorf("invalid modulus of JWK %q, %v", key.Kid, err)
+			}
+
+			e, err := base64.RawURLEncoding.DecodeString(key.E)
+			if err != nil {
+				return fmt.Errorf("invalid exponent of JWK %q, %v", key.Kid, err)
+			}
+
+			v.keys[key.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case key.Kty == "OKP" && key.Crv == "Ed25519":
+			x, err := base64.RawURLEncoding.DecodeString(key.X)
+			if err != nil || len(x) != ed25519.PublicKeySize {
+				return fmt.Errorf("invalid Ed25519 JWK %q", key.Kid)
+			}
+
+			v.keys[key.Kid] = ed25519.PublicKey(x)
+		}
+	}
+
+	return nil
+}
+
+func (v *JWTVerifier) loadKeyRing(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading key ring, %s", err)
+		}
+
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return fmt.Errorf("no PEM data in %s", path)
+		}
+
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("unable to parse public key %s, %v", path, err)
+		}
+
+		switch key.(type) {
+		case *rsa.PublicKey, ed25519.PublicKey:
+		default:
+			return fmt.Errorf("public key %s is neither an RSA nor an Ed25519 key", path)
+		}
+
+		v.keys[strings.TrimSuffix(filepath.Base(path), ".pem")] = key
+	}
+
+	return nil
+}
+
+// key returns the public key verifying token, checking it's signed with an
+// allowed algorithm matching the key type
+func (v *JWTVerifier) key(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := v.keys[kid]
+
+	// tokens may leave kid out when there is a single key
+	if !ok && kid == "" && len(v.keys) == 1 {
+		for _, only := range v.keys {
+			key, ok = only, true
+		}
+	}
+
+	if !ok {
+		return nil, ErrJWTKeyNotFound
+	}
+
+	switch key.(type) {
+	case *rsa.PublicKey:
+		if token.Method != jwt.SigningMethodRS256 {
+			return nil, ErrJWTAlgorithm
+		}
+	case ed25519.PublicKey:
+		if token.Method != SigningMethodEdDSA {
+			return nil, ErrJWTAlgorithm
+		}
+	}
+
+	return key, nil
+}
+
+// Verify checks the signature, validity, issuer and audience of a JWT access
+// token and returns its claims
+func (v *JWTVerifier) Verify(token string) (*AccessClaims, error) {
+	claims := new(AccessClaims)
+
+	if _, err := jwt.ParseWithClaims(token, claims, v.key); err != nil {
+		return nil, err
+	}
+
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return nil, errors.New("token issuer not accepted")
+	}
+
+	if v.audience != "" && !stringInSlice(v.audience, claims.Audience) {
+		return nil, errors.New("token audience not accepted")
+	}
+
+	if _, err := uuid.Parse(claims.Subject); err != nil {
+		return nil, errors.New("token subject must be a user id")
+	}
+
+	return claims, nil
+}
+
+// isJWT tells JWTs, made of three dot separated segments, from opaque tokens
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
@@ -0,0 +1,147 @@
+package authorization
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	jwt "github.com/form3tech-oss/jwt-go"
+	uuid "github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func TestJWTVerifier(t *testing.T) {
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := fmt.Sprintf(`{"keys": [{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": %q, "e": %q}]}`,
+		base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+	)
+
+	if err = ioutil.WriteFile(filepath.Join(dir, "jwks.json"), []byte(jwks), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(edPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyRing := filepath.Join(dir, "keys")
+
+	if err = os.Mkdir(keyRing, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(keyRing, "ed-1.pem"), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := NewJWTVerifier(filepath.Join(dir, "jwks.json"), keyRing, "https://id.resonate.coop", "user-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userID := uuid.New().String()
+
+	claims := func(overrides jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"sub":       userID,
+			"iss":       "https://id.resonate.coop",
+			"aud":       "user-api",
+			"exp":       time.Now().Add(time.Hour).Unix(),
+			"scope":     "users:read groups:write",
+			"role":      "tenantadmin",
+			"tenant_id": 3,
+		}
+
+		for k, value := range overrides {
+			c[k] = value
+		}
+
+		return c
+	}
+
+	verified, err := v.Verify(signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims(nil)))
+	if assert.Nil(t, err) {
+		assert.Equal(t, userID, verified.Subject)
+		assert.Equal(t, "tenantadmin", verified.Role)
+		assert.Equal(t, int32(3), verified.TenantID)
+		assert.Equal(t, "users:read groups:write", verified.Scope)
+	}
+
+	_, err = v.Verify(signToken(t, SigningMethodEdDSA, "ed-1", edPrivate, claims(jwt.MapClaims{"aud": []string{"other", "user-api"}})))
+	assert.Nil(t, err)
+
+	// keys only verify tokens signed with the algorithm matching their type
+	_, err = v.Verify(signToken(t, jwt.SigningMethodHS256, "rsa-1", []byte("secret"), claims(nil)))
+	assert.NotNil(t, err)
+
+	_, err = v.Verify(signToken(t, jwt.SigningMethodRS256, "ed-1", rsaKey, claims(nil)))
+	assert.NotNil(t, err)
+
+	_, err = v.Verify(signToken(t, jwt.SigningMethodRS256, "unknown", rsaKey, claims(nil)))
+	assert.NotNil(t, err)
+
+	for _, overrides := range []jwt.MapClaims{
+		{"exp": time.Now().Add(-time.Minute).Unix()},
+		{"exp": nil},
+		{"iss": "https://elsewhere"},
+		{"aud": "other-api"},
+		{"sub": "not-a-uuid"},
+	} {
+		c := claims(overrides)
+
+		for k, value := range overrides {
+			if value == nil {
+				delete(c, k)
+			}
+		}
+
+		_, err = v.Verify(signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, c))
+		assert.NotNil(t, err, "claims %v", overrides)
+	}
+}
+
+func TestNewJWTVerifierUnconfigured(t *testing.T) {
+	v, err := NewJWTVerifier("", "", "", "")
+	assert.Nil(t, v)
+	assert.Nil(t, err)
+}
+
+func TestIsJWT(t *testing.T) {
+	assert.True(t, isJWT("header.payload.signature"))
+	assert.False(t, isJWT(uuid.New().String()))
+}
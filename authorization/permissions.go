@@ -0,0 +1,115 @@
+package authorization
+
+import "strings"
+
+// Permission scopes an access token can grant, seeded in the scopes table
+const (
+	ScopeUsersRead        = "users:read"
+	ScopeUsersWrite       = "users:write"
+	ScopeGroupsRead       = "groups:read"
+	ScopeGroupsWrite      = "groups:write"
+	ScopeMembershipsRead  = "memberships:read"
+	ScopeMembershipsWrite = "memberships:write"
+	ScopeCreditsRead      = "credits:read"
+	ScopeCreditsWrite     = "credits:write"
+	ScopeTenantsRead      = "tenants:read"
+	ScopeTenantsWrite     = "tenants:write"
+	ScopeRolesRead        = "roles:read"
+	ScopeRolesWrite       = "roles:write"
+)
+
+// Legacy scopes, standing for every read permission, or every read and
+// write permission
+const (
+	ScopeRead      = "read"
+	ScopeReadWrite = "read_write"
+)
+
+// MethodScopes is the permission scope an access token needs to call each
+// method
+var MethodScopes = map[string]string{
+	"/user.ResonateUser/GetUser":                    ScopeUsersRead,
+	"/user.ResonateUser/AddUser":                    ScopeUsersWrite,
+	"/user.ResonateUser/ConfirmEmail":               ScopeUsersWrite,
+	"/user.ResonateUser/ConfirmEmailChange":         ScopeUsersWrite,
+	"/user.ResonateUser/ListUsernameChanges":        ScopeUsersRead,
+	"/user.ResonateUser/UpdateUser":                 ScopeUsersWrite,
+	"/user.ResonateUser/UpdateUserRestricted":       ScopeUsersWrite,
+	"/user.ResonateUser/BatchUpdateUsersRestricted": ScopeUsersWrite,
+	"/user.ResonateUser/RequestPasswordReset":       ScopeUsersWrite,
+	"/user.ResonateUser/ResetUserPassword":          ScopeUsersWrite,
+	"/user.ResonateUser/ChangePassword":             ScopeUsersWrite,
+	"/user.ResonateUser/GetUserRestricted":          ScopeUsersRead,
+	"/user.ResonateUser/DeleteUser":                 ScopeUsersWrite,
+	"/user.ResonateUser/RestoreUser":                ScopeUsersWrite,
+	"/user.ResonateUser/AnonymizeUser":              ScopeUsersWrite,
+	"/user.ResonateUser/ListDeletedUsers":           ScopeUsersRead,
+	"/user.ResonateUser/ListUsers":                  ScopeUsersRead,
+	"/user.ResonateUser/SearchUsers":                ScopeUsersRead,
+	"/user.ResonateUser/ExportUserData":             ScopeUsersRead,
+	"/user.ResonateUser/FollowGroup":                ScopeUsersWrite,
+	"/user.ResonateUser/UnfollowGroup":              ScopeUsersWrite,
+	"/user.ResonateUser/GrantMembership":            ScopeMembershipsWrite,
+	"/user.ResonateUser/RenewMembership":            ScopeMembershipsWrite,
+	"/user.ResonateUser/LapseMembership":            ScopeMembershipsWrite,
+	"/user.ResonateUser/ListUserMemberships":        ScopeMembershipsRead,
+	"/user.ResonateUser/PostCreditTransaction":      ScopeCreditsWrite,
+	"/user.ResonateUser/GetUserCredits":             ScopeCreditsRead,
+	"/user.ResonateUser/CreateTenant":               ScopeTenantsWrite,
+	"/user.ResonateUser/RenameTenant":               ScopeTenantsWrite,
+	"/user.ResonateUser/ActivateTenant":             ScopeTenantsWrite,
+	"/user.ResonateUser/DeactivateTenant":           ScopeTenantsWrite,
+	"/user.ResonateUser/ListTenants":                ScopeTenantsRead,
+	"/user.ResonateUser/ListRoles":                  ScopeRolesRead,
+	"/user.ResonateUser/GetRole":                    ScopeRolesRead,
+	"/user.ResonateUser/SetDefaultRole":             ScopeRolesWrite,
+	"/user.ResonateUser/ListRoleUsers":              ScopeRolesRead,
+	"/user.ResonateUser/AddUserGroup":               ScopeGroupsWrite,
+	"/user.ResonateUser/UpdateUserGroup":            ScopeGroupsWrite,
+	"/user.ResonateUser/GetUserGroup":               ScopeGroupsRead,
+	"/user.ResonateUser/DeleteUserGroup":            ScopeGroupsWrite,
+	"/user.ResonateUser/ListGroupFollowers":         ScopeGroupsRead,
+	"/user.ResonateUser/ListUsersUserGroups":        ScopeGroupsRead,
+}
+
+// isPermissionScope reports whether scope is a permission scope, as opposed
+// to a legacy scope or a role name
+func isPermissionScope(scope string) bool {
+	return strings.HasSuffix(scope, ":read") || strings.HasSuffix(scope, ":write")
+}
+
+// GrantedScopes returns the permission scopes granted by the scopes of a
+// token, expanding the legacy read and read_write scopes
+func GrantedScopes(scopes []string) map[string]bool {
+	granted := make(map[string]bool)
+
+	for _, scope := range scopes {
+		switch {
+		case scope == ScopeRead || scope == ScopeReadWrite:
+			for _, permission := range MethodScopes {
+				if strings.HasSuffix(permission, ":read") || scope == ScopeReadWrite {
+					granted[permission] = true
+				}
+			}
+		case isPermissionScope(scope):
+			granted[scope] = true
+		}
+	}
+
+	return granted
+}
+
+// roleScopes returns the scopes of a token that may name roles, which legacy
+// tokens carry instead of a role claim. Other scopes, like openid, are left
+// for roleID to ignore
+func roleScopes(scopes []string) []string {
+	var names []string
+
+	for _, scope := range scopes {
+		if scope != ScopeRead && scope != ScopeReadWrite && !isPermissionScope(scope) {
+			names = append(names, scope)
+		}
+	}
+
+	return names
+}
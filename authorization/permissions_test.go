@@ -0,0 +1,38 @@
+package authorization
+
+import (
+	"testing"
+
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEveryMethodHasAScope(t *testing.T) {
+	for _, method := range pbUser.ResonateUser_ServiceDesc.Methods {
+		name := "/" + pbUser.ResonateUser_ServiceDesc.ServiceName + "/" + method.MethodName
+		assert.Contains(t, MethodScopes, name)
+	}
+}
+
+func TestGrantedScopes(t *testing.T) {
+	granted := GrantedScopes([]string{"groups:read", "user"})
+	assert.True(t, granted[ScopeGroupsRead])
+	assert.False(t, granted[ScopeGroupsWrite])
+	assert.Len(t, granted, 1)
+
+	granted = GrantedScopes([]string{ScopeRead})
+	assert.True(t, granted[ScopeUsersRead])
+	assert.True(t, granted[ScopeTenantsRead])
+	assert.False(t, granted[ScopeUsersWrite])
+
+	granted = GrantedScopes([]string{ScopeReadWrite})
+	assert.True(t, granted[ScopeUsersRead])
+	assert.True(t, granted[ScopeRolesWrite])
+
+	assert.Empty(t, GrantedScopes(nil))
+}
+
+func TestRoleScopes(t *testing.T) {
+	assert.Equal(t, []string{"admin"}, roleScopes([]string{"read_write", "admin", "users:read"}))
+	assert.Empty(t, roleScopes([]string{"read"}))
+}
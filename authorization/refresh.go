@@ -0,0 +1,151 @@
+package authorization
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	uuid "github.com/google/uuid"
+	"github.com/uptrace/bun"
+	grpclog "google.golang.org/grpc/grpclog"
+
+	"github.com/resonatecoop/user-api-template/model"
+)
+
+// DefaultRefreshExtendInterval is how often pending refresh token extensions
+// are written when no interval is configured
+const DefaultRefreshExtendInterval = 10 * time.Second
+
+// refreshKey identifies the refresh tokens of a client and user, uuid.Nil
+// for tokens issued to the client itself
+type refreshKey struct {
+	clientID uuid.UUID
+	userID   uuid.UUID
+}
+
+// RefreshExtender slides the expiry of refresh tokens in the background.
+// Requests authenticated for the same client and user between two flushes
+// make a single UPDATE, extending the tokens from the latest request.
+type RefreshExtender struct {
+	db       *bun.DB
+	lifetime time.Duration
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[refreshKey]time.Time
+
+	// flushMu serializes flushes, so the last one on Close sees extensions
+	// requeued by a failed earlier one
+	flushMu sync.Mutex
+	closed  bool
+}
+
+// NewRefreshExtender returns a RefreshExtender extending refresh tokens by
+// lifetime, flushing at most once per interval
+func NewRefreshExtender(db *bun.DB, lifetime time.Duration, interval time.Duration) *RefreshExtender {
+	if interval <= 0 {
+		interval = DefaultRefreshExtendInterval
+	}
+
+	return &RefreshExtender{
+		db:       db,
+		lifetime: lifetime,
+		interval: interval,
+		pending:  make(map[refreshKey]time.Time),
+	}
+}
+
+// Extend queues extending the refresh tokens of a client and user from now
+func (e *RefreshExtender) Extend(clientID uuid.UUID, userID uuid.UUID) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.pending[refreshKey{clientID, userID}] = time.Now().UTC()
+}
+
+// Run flushes pending extensions once per interval until ctx is cancelled
+func (e *RefreshExtender) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := e.Flush(ctx); err != nil {
+			grpclog.Errorf("[user-api-auth] extending refresh tokens failed: %v", err)
+		}
+	}
+}
+
+// Flush writes the pending extensions. Those that fail are queued again,
+// unless a later request queued a newer one meanwhile.
+func (e *RefreshExtender) Flush(ctx context.Context) error {
+	e.flushMu.Lock()
+	defer e.flushMu.Unlock()
+
+	if e.closed {
+		return nil
+	}
+
+	return e.flush(ctx)
+}
+
+// Close writes the pending extensions a last time, for shutdown
+func (e *RefreshExtender) Close(ctx context.Context) error {
+	e.flushMu.Lock()
+	defer e.flushMu.Unlock()
+
+	if e.closed {
+		return nil
+	}
+
+	e.closed = true
+
+	return e.flush(ctx)
+}
+
+func (e *RefreshExtender) flush(ctx context.Context) error {
+	e.mu.Lock()
+	pending := e.pending
+	e.pending = make(map[refreshKey]time.Time, len(pending))
+	e.mu.Unlock()
+
+	var firstErr error
+
+	for key, requestedAt := range pending {
+		q := e.db.NewUpdate().
+			Model((*model.RefreshToken)(nil)).
+			Set("expires_at = ?", requestedAt.Add(e.lifetime)).
+			Set("updated_at = ?", time.Now().UTC()).
+			Where("client_id = ?", key.clientID)
+
+		if key.userID != uuid.Nil {
+			q.Where("user_id = ?", key.userID)
+		} else {
+			q.Where("user_id = uuid_nil()")
+		}
+
+		if _, err := q.Exec(ctx); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+
+			e.requeue(key, requestedAt)
+		}
+	}
+
+	return firstErr
+}
+
+func (e *RefreshExtender) requeue(key refreshKey, requestedAt time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, ok := e.pending[key]; !ok {
+		e.pending[key] = requestedAt
+	}
+}
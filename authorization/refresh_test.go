@@ -0,0 +1,56 @@
+package authorization
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	uuid "github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshExtenderCoalesces(t *testing.T) {
+	e := NewRefreshExtender(nil, time.Hour, 0)
+
+	assert.Equal(t, DefaultRefreshExtendInterval, e.interval)
+
+	clientID, userID := uuid.New(), uuid.New()
+
+	e.Extend(clientID, userID)
+	first := e.pending[refreshKey{clientID, userID}]
+
+	e.Extend(clientID, userID)
+	e.Extend(clientID, uuid.Nil)
+
+	assert.Len(t, e.pending, 2)
+	assert.False(t, e.pending[refreshKey{clientID, userID}].Before(first))
+}
+
+func TestRefreshExtenderRequeue(t *testing.T) {
+	e := NewRefreshExtender(nil, time.Hour, time.Second)
+
+	key := refreshKey{uuid.New(), uuid.New()}
+	failed := time.Now().Add(-time.Minute)
+
+	e.Extend(key.clientID, key.userID)
+	newer := e.pending[key]
+
+	// a failed flush doesn't replace an extension queued since
+	e.requeue(key, failed)
+	assert.Equal(t, newer, e.pending[key])
+
+	delete(e.pending, key)
+	e.requeue(key, failed)
+	assert.Equal(t, failed, e.pending[key])
+}
+
+func TestRefreshExtenderClose(t *testing.T) {
+	e := NewRefreshExtender(nil, time.Hour, time.Second)
+
+	assert.Nil(t, e.Close(context.Background()))
+
+	// flushes after closing are no-ops
+	e.Extend(uuid.New(), uuid.New())
+	assert.Nil(t, e.Flush(context.Background()))
+	assert.Len(t, e.pending, 1)
+}
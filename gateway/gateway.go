@@ -3,18 +3,22 @@ package gateway
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"mime"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/rakyll/statik/fs"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/status"
 
 	"github.com/resonatecoop/user-api-template/insecure"
 	pbUser "github.com/resonatecoop/user-api-template/proto/user"
@@ -37,8 +41,42 @@ func getOpenAPIHandler() http.Handler {
 	return http.FileServer(statikFS)
 }
 
-// Run runs the gRPC-Gateway, dialling the provided address.
-func Run(dialAddr string) error {
+// outgoingHeaderMatcher sends record versions as the ETag header, other
+// response metadata keeps the default Grpc-Metadata- prefix
+func outgoingHeaderMatcher(key string) (string, bool) {
+	if key == "etag" {
+		return "ETag", true
+	}
+	return runtime.MetadataHeaderPrefix + key, true
+}
+
+// errorHandler answers updates rejected for a stale version or If-Match with
+// 412 Precondition Failed instead of the default 409 Conflict
+func errorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	if status.Code(err) == codes.Aborted {
+		w = &statusWriter{ResponseWriter: w, status: http.StatusPreconditionFailed}
+	}
+	runtime.DefaultHTTPErrorHandler(ctx, mux, marshaler, w, r, err)
+}
+
+// statusWriter replaces the status code written to a ResponseWriter
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(int) {
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// ShutdownTimeout is how long Run waits for in-flight requests once its
+// context is cancelled
+const ShutdownTimeout = 10 * time.Second
+
+// Run runs the gRPC-Gateway, dialling the provided address, until ctx is
+// cancelled. It then stops accepting requests and returns once those in
+// flight are answered, or after ShutdownTimeout.
+func Run(ctx context.Context, dialAddr string) error {
 	// Adds gRPC internal logs. This is quite verbose, so adjust as desired!
 	log := grpclog.NewLoggerV2(os.Stdout, ioutil.Discard, ioutil.Discard)
 	grpclog.SetLoggerV2(log)
@@ -46,7 +84,7 @@ func Run(dialAddr string) error {
 	// Create a client connection to the gRPC Server we just started.
 	// This is where the gRPC-Gateway proxies the requests.
 	conn, err := grpc.DialContext(
-		context.Background(),
+		ctx,
 		dialAddr,
 		grpc.WithTransportCredentials(credentials.NewClientTLSFromCert(insecure.CertPool, "")),
 		grpc.WithBlock(),
@@ -54,9 +92,13 @@ func Run(dialAddr string) error {
 	if err != nil {
 		return fmt.Errorf("failed to dial server: %w", err)
 	}
+	defer conn.Close()
 
-	gwmux := runtime.NewServeMux()
-	err = pbUser.RegisterResonateUserHandler(context.Background(), gwmux, conn)
+	gwmux := runtime.NewServeMux(
+		runtime.WithOutgoingHeaderMatcher(outgoingHeaderMatcher),
+		runtime.WithErrorHandler(errorHandler),
+	)
+	err = pbUser.RegisterResonateUserHandler(ctx, gwmux, conn)
 
 	if err != nil {
 		return fmt.Errorf("failed to register gateway: %w", err)
@@ -79,15 +121,34 @@ func Run(dialAddr string) error {
 			oa.ServeHTTP(w, r)
 		}),
 	}
+
+	shutdown := make(chan error, 1)
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		defer cancel()
+
+		shutdown <- gwServer.Shutdown(shutdownCtx)
+	}()
+
 	// Empty parameters mean use the TLS Config specified with the server.
 	if strings.ToLower(os.Getenv("SERVE_HTTP")) == "true" {
 		log.Info("Serving gRPC-Gateway and OpenAPI Documentation on http://", gatewayAddr)
-		return fmt.Errorf("serving gRPC-Gateway server: %w", gwServer.ListenAndServe())
+		err = gwServer.ListenAndServe()
+	} else {
+		gwServer.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{insecure.Cert},
+		}
+		log.Info("Serving gRPC-Gateway and OpenAPI Documentation on https://", gatewayAddr)
+		err = gwServer.ListenAndServeTLS("", "")
 	}
 
-	gwServer.TLSConfig = &tls.Config{
-		Certificates: []tls.Certificate{insecure.Cert},
+	// ListenAndServe returns as soon as Shutdown starts, wait for it to finish
+	if errors.Is(err, http.ErrServerClosed) {
+		return <-shutdown
 	}
-	log.Info("Serving gRPC-Gateway and OpenAPI Documentation on https://", gatewayAddr)
-	return fmt.Errorf("serving gRPC-Gateway server: %w", gwServer.ListenAndServeTLS("", ""))
+
+	return fmt.Errorf("serving gRPC-Gateway server: %w", err)
 }
@@ -0,0 +1,56 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	uuid "github.com/google/uuid"
+)
+
+// ErrInvalidPageToken is returned when a page token cannot be decoded
+var ErrInvalidPageToken = errors.New("page token is not valid")
+
+// Cursor is the decoded form of an opaque page token. It holds the sort key
+// and id of the last row of the previous page, so that the next page can be
+// fetched with a keyset condition instead of an OFFSET.
+type Cursor struct {
+	OrderBy string    `json:"o"`
+	Key     string    `json:"k"`
+	ID      uuid.UUID `json:"i"`
+}
+
+// Encode returns the opaque page token for the supplied cursor
+func Encode(c *Cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode parses a page token produced by Encode
+func Decode(token string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+
+	c := new(Cursor)
+
+	if err := json.Unmarshal(data, c); err != nil || c.ID == uuid.Nil {
+		return nil, ErrInvalidPageToken
+	}
+
+	return c, nil
+}
+
+// PageSize returns the requested page size, falling back to def when unset
+// and capping it at max
+func PageSize(requested, def, max int32) int {
+	switch {
+	case requested <= 0:
+		return int(def)
+	case requested > max:
+		return int(max)
+	default:
+		return int(requested)
+	}
+}
@@ -0,0 +1,45 @@
+package pagination_test
+
+import (
+	"testing"
+
+	uuid "github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/resonatecoop/user-api-template/internal/pkg/pagination"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	c := &pagination.Cursor{
+		OrderBy: "-created_at",
+		Key:     "2021-05-22T01:01:01.123456Z",
+		ID:      uuid.MustParse("243b4178-6f98-4bf1-bbb1-46b57a901816"),
+	}
+
+	decoded, err := pagination.Decode(pagination.Encode(c))
+
+	assert.Nil(t, err)
+	assert.Equal(t, c, decoded)
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	cases := map[string]string{
+		"not base64": "%%%",
+		"not json":   "bm90IGpzb24",
+		"missing id": pagination.Encode(&pagination.Cursor{OrderBy: "created_at"}),
+	}
+
+	for name, token := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := pagination.Decode(token)
+			assert.Equal(t, pagination.ErrInvalidPageToken, err)
+		})
+	}
+}
+
+func TestPageSize(t *testing.T) {
+	assert.Equal(t, 50, pagination.PageSize(0, 50, 500))
+	assert.Equal(t, 50, pagination.PageSize(-1, 50, 500))
+	assert.Equal(t, 20, pagination.PageSize(20, 50, 500))
+	assert.Equal(t, 500, pagination.PageSize(1000, 50, 500))
+}
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"io/ioutil"
 	"log"
 	"net"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/uptrace/bun/dbfixture"
 	"github.com/uptrace/bun/migrate"
@@ -39,6 +44,7 @@ func main() {
 		Commands: []*cli.Command{
 			runServerCommand,
 			newDBCommand(migrations.Migrations),
+			newUsersCommand(),
 		},
 	}
 	if err := app.Run(os.Args); err != nil {
@@ -81,9 +87,21 @@ var runServerCommand = &cli.Command{
 
 		db := apiapp.DB(c.String("env"), dbdebug)
 
-		accService := acc.New(cfg.Access.NoTokenMethods, cfg.Access.PublicMethods, cfg.Access.WriteMethods)
+		accService := acc.New(cfg.Access.NoTokenMethods, cfg.Access.PublicMethods, cfg.Access.WriteMethods, cfg.Access.AdminMethods)
 
-		interceptorAuth := authorization.NewAuthInterceptor(db, cfg.RefreshToken.Lifetime, accService)
+		authCache := authorization.NewCache(time.Duration(cfg.AuthCache.TTL)*time.Second, cfg.AuthCache.MaxEntries)
+
+		refreshExtender := authorization.NewRefreshExtender(
+			db,
+			time.Duration(cfg.RefreshToken.Lifetime)*time.Second,
+			time.Duration(cfg.RefreshToken.ExtendInterval)*time.Second,
+		)
+
+		jwtVerifier, err := authorization.NewJWTVerifier(cfg.JWT.JWKSFile, cfg.JWT.KeyRingDir, cfg.JWT.Issuer, cfg.JWT.Audience)
+
+		checkErr(log, err)
+
+		interceptorAuth := authorization.NewAuthInterceptor(db, refreshExtender, accService, authCache, jwtVerifier)
 
 		addr := "0.0.0.0:10000"
 		lis, err := net.Listen("tcp", addr)
@@ -104,18 +122,70 @@ var runServerCommand = &cli.Command{
 			opts...,
 		)
 
-		pbUser.RegisterResonateUserServer(s, userserver.New(db))
+		userServer := userserver.New(db, cfg, userserver.WithAuthCache(authCache))
+
+		pbUser.RegisterResonateUserServer(s, userServer)
+
+		// Purge users whose deletion grace period has expired and keep
+		// member status in line with membership periods
+		purgeCtx, cancelPurge := context.WithCancel(c.Context)
+
+		apiapp.OnStop("users.maintenance", func(ctx context.Context, _ *app.App) error {
+			cancelPurge()
+			return nil
+		})
+
+		go userServer.RunPurge(purgeCtx)
+		go userServer.RunMembershipSync(purgeCtx)
+
+		// Write refresh token extensions in the background, and what's left
+		// of them on shutdown
+		extendCtx, cancelExtend := context.WithCancel(c.Context)
+
+		apiapp.OnStop("refreshtoken.extend", func(ctx context.Context, _ *app.App) error {
+			cancelExtend()
+			return refreshExtender.Close(ctx)
+		})
+
+		go refreshExtender.Run(extendCtx)
+
+		// Log the hit rates of the auth cache
+		go authCache.LogStats(c.Context, time.Duration(cfg.AuthCache.StatsInterval)*time.Second)
 
 		// Serve gRPC Server
 		log.Info("Serving gRPC on https://", addr)
 		go func() {
-			log.Fatal(s.Serve(lis))
+			// Serve returns nil once GracefulStop is called
+			if err := s.Serve(lis); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+				log.Fatal(err)
+			}
 		}()
 
-		err = gateway.Run("dns:///" + addr)
-		log.Fatal(err)
+		gatewayCtx, stopGateway := context.WithCancel(c.Context)
+		gatewayStopped := make(chan struct{})
+
+		go func() {
+			defer close(gatewayStopped)
+
+			if err := gateway.Run(gatewayCtx, "dns:///"+addr); err != nil {
+				if gatewayCtx.Err() == nil {
+					log.Fatal(err)
+				}
+				log.Error(err)
+			}
+		}()
+
+		log.Info("Received signal ", app.WaitExitSignal(), ", shutting down")
 
-		return err
+		// Stop the gateway before the gRPC server it proxies requests to, then
+		// run the stop hooks flushing what's left in the background
+		stopGateway()
+		<-gatewayStopped
+
+		s.GracefulStop()
+		apiapp.Stop()
+
+		return nil
 	},
 }
 
@@ -290,6 +360,92 @@ func newDBCommand(migrations *migrate.Migrations) *cli.Command {
 					return err
 				},
 			},
+			{
+				Name:  "purge_users",
+				Usage: "hard delete users whose deletion grace period has expired",
+				Action: func(c *cli.Context) error {
+					ctx, app, err := app.StartCLI(c)
+					if err != nil {
+						return err
+					}
+					defer app.Stop()
+
+					dbdebug := false
+
+					if c.String("dbdebug") == "true" {
+						dbdebug = true
+					}
+
+					userServer := userserver.New(app.DB(c.String("env"), dbdebug), app.Cfg)
+
+					purged, err := userServer.PurgeExpiredUsers(ctx)
+
+					if err != nil {
+						return err
+					}
+
+					log.Printf("purged %d deleted users", purged)
+
+					return nil
+				},
+			},
+			{
+				Name:      "export-user",
+				Usage:     "export all data held about a user as JSON",
+				ArgsUsage: "<id>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "zip",
+						Usage: "wrap the JSON document in a zip archive",
+					},
+					&cli.StringFlag{
+						Name:  "output",
+						Usage: "file to write the export to (defaults to user-<id>-export.json or .zip)",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.Args().Len() != 1 {
+						return cli.Exit("export-user expects a single user id", 1)
+					}
+
+					ctx, app, err := app.StartCLI(c)
+					if err != nil {
+						return err
+					}
+					defer app.Stop()
+
+					dbdebug := false
+
+					if c.String("dbdebug") == "true" {
+						dbdebug = true
+					}
+
+					userServer := userserver.New(app.DB(c.String("env"), dbdebug), app.Cfg)
+
+					export, err := userServer.ExportUserData(ctx, &pbUser.UserExportRequest{
+						Id:  c.Args().Get(0),
+						Zip: c.Bool("zip"),
+					})
+
+					if err != nil {
+						return err
+					}
+
+					output := c.String("output")
+
+					if output == "" {
+						output = export.Filename
+					}
+
+					if err = ioutil.WriteFile(output, export.Data, 0600); err != nil {
+						return err
+					}
+
+					log.Printf("exported user %s to %s", c.Args().Get(0), output)
+
+					return nil
+				},
+			},
 			{
 				Name:  "load_default_fixtures",
 				Usage: "load default data",
@@ -374,6 +530,146 @@ func newDBCommand(migrations *migrate.Migrations) *cli.Command {
 	}
 }
 
+func newUsersCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "users",
+		Usage: "manage users",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "env",
+				Value: "dev",
+				Usage: "runtime environment (dev, test, prod) (defaults to dev, prod uses env variables for connections)",
+			},
+			&cli.StringFlag{
+				Name:  "dbdebug",
+				Value: "false",
+				Usage: "show database queries true/false",
+			},
+		},
+		Subcommands: []*cli.Command{
+			{
+				Name:      "import",
+				Usage:     "create or update users by username from a CSV or JSONL file",
+				ArgsUsage: "<file>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "csv or jsonl (defaults to the file extension)",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "validate the file and report what would change without writing",
+					},
+					&cli.IntFlag{
+						Name:  "role-id",
+						Usage: "role of imported users that don't set role_id",
+					},
+					&cli.IntFlag{
+						Name:  "tenant-id",
+						Usage: "tenant of imported users that don't set tenant_id",
+					},
+					&cli.BoolFlag{
+						Name:  "send-confirmation",
+						Usage: "email created users a link to confirm their address",
+					},
+					&cli.StringFlag{
+						Name:  "report",
+						Usage: "file to write the per-row CSV report to (defaults to stdout)",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.Args().Len() != 1 {
+						return cli.Exit("import expects a single file", 1)
+					}
+
+					path := c.Args().Get(0)
+
+					format := c.String("format")
+
+					if format == "" {
+						format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+					}
+
+					f, err := os.Open(path)
+					if err != nil {
+						return err
+					}
+					defer f.Close()
+
+					rows, err := userserver.ReadImportRows(f, format)
+					if err != nil {
+						return err
+					}
+
+					ctx, app, err := app.StartCLI(c)
+					if err != nil {
+						return err
+					}
+					defer app.Stop()
+
+					dbdebug := false
+
+					if c.String("dbdebug") == "true" {
+						dbdebug = true
+					}
+
+					userServer := userserver.New(app.DB(c.String("env"), dbdebug), app.Cfg)
+
+					opts := userserver.ImportOptions{DryRun: c.Bool("dry-run"), SendConfirmation: c.Bool("send-confirmation")}
+
+					if c.IsSet("role-id") {
+						roleID := int32(c.Int("role-id"))
+						opts.RoleID = &roleID
+					}
+
+					if c.IsSet("tenant-id") {
+						tenantID := int32(c.Int("tenant-id"))
+						opts.TenantID = &tenantID
+					}
+
+					results, err := userServer.ImportUsers(ctx, rows, opts)
+					if err != nil {
+						return err
+					}
+
+					report := os.Stdout
+
+					if c.String("report") != "" {
+						if report, err = os.Create(c.String("report")); err != nil {
+							return err
+						}
+						defer report.Close()
+					}
+
+					if err = userserver.WriteImportReport(report, results); err != nil {
+						return err
+					}
+
+					counts := make(map[string]int)
+
+					for _, result := range results {
+						counts[result.Action]++
+					}
+
+					if opts.DryRun {
+						log.Print("dry run, nothing was written")
+					}
+
+					log.Printf(
+						"imported %d rows: %d created, %d updated, %d failed",
+						len(results),
+						counts[userserver.ImportCreated],
+						counts[userserver.ImportUpdated],
+						counts[userserver.ImportFailed],
+					)
+
+					return nil
+				},
+			},
+		},
+	}
+}
+
 func checkErr(log grpclog.LoggerV2, err error) {
 	if err != nil {
 		log.Fatal(err)
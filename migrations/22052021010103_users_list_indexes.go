@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [up migration] ")
+
+		// keyset pagination of ListUsers seeks on (sort column, id)
+		for _, column := range []string{"created_at", "updated_at"} {
+			_, err := db.ExecContext(ctx, "CREATE INDEX IF NOT EXISTS ? ON users (?, id)",
+				bun.Ident("users_"+column+"_id_idx"), bun.Ident(column))
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [down migration] ")
+
+		for _, column := range []string{"created_at", "updated_at"} {
+			_, err := db.ExecContext(ctx, "DROP INDEX IF EXISTS ?", bun.Ident("users_"+column+"_id_idx"))
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
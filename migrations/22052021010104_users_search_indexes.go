@@ -0,0 +1,49 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/uptrace/bun"
+
+	"github.com/resonatecoop/user-api-template/model"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [up migration] ")
+
+		if _, err := db.ExecContext(ctx, `CREATE EXTENSION IF NOT EXISTS "pg_trgm"`); err != nil {
+			return err
+		}
+
+		// Both indexes must be built over the same expression SearchUsers queries
+		if _, err := db.ExecContext(ctx, `
+      CREATE INDEX IF NOT EXISTS users_search_gin_idx ON users
+      USING GIN (to_tsvector('simple', `+model.UserSearchDocument+`))
+    `); err != nil {
+			return err
+		}
+
+		if _, err := db.ExecContext(ctx, `
+      CREATE INDEX IF NOT EXISTS users_search_trgm_idx ON users
+      USING GIN ((`+model.UserSearchDocument+`) gin_trgm_ops)
+    `); err != nil {
+			return err
+		}
+
+		return nil
+	}, func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [down migration] ")
+
+		if _, err := db.ExecContext(ctx, `DROP INDEX IF EXISTS users_search_trgm_idx`); err != nil {
+			return err
+		}
+
+		if _, err := db.ExecContext(ctx, `DROP INDEX IF EXISTS users_search_gin_idx`); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,36 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [up migration] ")
+
+		if _, err := db.ExecContext(ctx, `
+      ALTER TABLE email_tokens
+      ADD COLUMN IF NOT EXISTS user_id uuid,
+      ADD COLUMN IF NOT EXISTS used_at timestamptz
+    `); err != nil {
+			return err
+		}
+
+		_, err := db.ExecContext(ctx, `CREATE UNIQUE INDEX IF NOT EXISTS email_tokens_reference_idx ON email_tokens (reference)`)
+
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [down migration] ")
+
+		if _, err := db.ExecContext(ctx, `DROP INDEX IF EXISTS email_tokens_reference_idx`); err != nil {
+			return err
+		}
+
+		_, err := db.ExecContext(ctx, `ALTER TABLE email_tokens DROP COLUMN IF EXISTS user_id, DROP COLUMN IF EXISTS used_at`)
+
+		return err
+	})
+}
@@ -0,0 +1,24 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [up migration] ")
+
+		_, err := db.ExecContext(ctx, `ALTER TABLE email_tokens ADD COLUMN IF NOT EXISTS purpose varchar(20) NOT NULL DEFAULT 'confirm_email'`)
+
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [down migration] ")
+
+		_, err := db.ExecContext(ctx, `ALTER TABLE email_tokens DROP COLUMN IF EXISTS purpose`)
+
+		return err
+	})
+}
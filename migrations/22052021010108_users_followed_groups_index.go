@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [up migration] ")
+
+		// followers of a user group are found by searching followed_groups
+		_, err := db.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS users_followed_groups_idx ON users USING GIN (followed_groups)`)
+
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [down migration] ")
+
+		_, err := db.ExecContext(ctx, `DROP INDEX IF EXISTS users_followed_groups_idx`)
+
+		return err
+	})
+}
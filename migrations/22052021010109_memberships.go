@@ -0,0 +1,60 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/uptrace/bun"
+
+	"github.com/resonatecoop/user-api-template/model"
+)
+
+// legacyMembershipPeriod is how long members from before memberships existed
+// stay members, counted from when this migration runs. Renew or lapse their
+// legacy memberships before it ends.
+const legacyMembershipPeriod = "1 year"
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [up migration] ")
+
+		_, err := db.NewCreateTable().
+			Model((*model.Membership)(nil)).
+			IfNotExists().
+			ForeignKey(`("user_id") REFERENCES "users" ("id") ON DELETE CASCADE`).
+			Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		if _, err = db.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS memberships_user_id_idx ON memberships (user_id, starts_at)`); err != nil {
+			return err
+		}
+
+		// Existing members keep their status for legacyMembershipPeriod as a
+		// legacy membership, since User.Member is now derived from active memberships
+		res, err := db.ExecContext(ctx, `
+      INSERT INTO memberships (user_id, membership_class, starts_at, ends_at, status, created_at, updated_at)
+      SELECT id, 'legacy', created_at, now() + ?::interval, 'active', now(), now()
+      FROM users
+      WHERE member AND deleted_at IS NULL
+    `, legacyMembershipPeriod)
+
+		if err != nil {
+			return err
+		}
+
+		granted, _ := res.RowsAffected()
+
+		fmt.Printf(" [granted %d legacy memberships ending in %s] ", granted, legacyMembershipPeriod)
+
+		return nil
+	}, func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [down migration] ")
+
+		_, err := db.NewDropTable().Model((*model.Membership)(nil)).IfExists().Exec(ctx)
+
+		return err
+	})
+}
@@ -0,0 +1,88 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/uptrace/bun"
+
+	"github.com/resonatecoop/user-api-template/model"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [up migration] ")
+
+		_, err := db.NewCreateTable().
+			Model((*model.CreditAccount)(nil)).
+			IfNotExists().
+			ForeignKey(`("user_id") REFERENCES "users" ("id") ON DELETE CASCADE`).
+			Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		// the last line of defence, spends already check the balance. ADD
+		// CONSTRAINT has no IF NOT EXISTS, drop it first so reruns succeed
+		if _, err = db.ExecContext(ctx, `
+      ALTER TABLE credit_accounts
+      DROP CONSTRAINT IF EXISTS credit_accounts_balance_check,
+      ADD CONSTRAINT credit_accounts_balance_check CHECK (balance >= 0)
+    `); err != nil {
+			return err
+		}
+
+		_, err = db.NewCreateTable().
+			Model((*model.CreditTransaction)(nil)).
+			IfNotExists().
+			ForeignKey(`("user_id") REFERENCES "users" ("id") ON DELETE CASCADE`).
+			Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = db.NewCreateTable().
+			Model((*model.CreditEntry)(nil)).
+			IfNotExists().
+			ForeignKey(`("transaction_id") REFERENCES "credit_transactions" ("id") ON DELETE CASCADE`).
+			Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		if _, err = db.ExecContext(ctx, `
+      CREATE UNIQUE INDEX IF NOT EXISTS credit_transactions_idempotency_idx
+      ON credit_transactions (user_id, idempotency_key)
+    `); err != nil {
+			return err
+		}
+
+		if _, err = db.ExecContext(ctx, `
+      CREATE INDEX IF NOT EXISTS credit_transactions_history_idx
+      ON credit_transactions (user_id, created_at, id)
+    `); err != nil {
+			return err
+		}
+
+		_, err = db.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS credit_entries_transaction_id_idx ON credit_entries (transaction_id)`)
+
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [down migration] ")
+
+		for _, m := range []interface{}{
+			(*model.CreditEntry)(nil),
+			(*model.CreditTransaction)(nil),
+			(*model.CreditAccount)(nil),
+		} {
+			if _, err := db.NewDropTable().Model(m).IfExists().Exec(ctx); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,62 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [up migration] ")
+
+		// every update bumps the version, whichever code path makes it
+		if _, err := db.ExecContext(ctx, `
+      CREATE OR REPLACE FUNCTION bump_record_version() RETURNS trigger AS $$
+      BEGIN
+        NEW.version := OLD.version + 1;
+        RETURN NEW;
+      END;
+      $$ LANGUAGE plpgsql
+    `); err != nil {
+			return err
+		}
+
+		for _, table := range []string{"users", "user_groups"} {
+			if _, err := db.ExecContext(ctx, `ALTER TABLE ? ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 1`, bun.Ident(table)); err != nil {
+				return err
+			}
+
+			// CREATE TRIGGER has no IF NOT EXISTS, drop it first so reruns succeed
+			if _, err := db.ExecContext(ctx, `DROP TRIGGER IF EXISTS ? ON ?`, bun.Ident(table+"_version_trigger"), bun.Ident(table)); err != nil {
+				return err
+			}
+
+			if _, err := db.ExecContext(ctx, `
+        CREATE TRIGGER ? BEFORE UPDATE ON ?
+        FOR EACH ROW EXECUTE PROCEDURE bump_record_version()
+      `, bun.Ident(table+"_version_trigger"), bun.Ident(table)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [down migration] ")
+
+		for _, table := range []string{"users", "user_groups"} {
+			if _, err := db.ExecContext(ctx, `DROP TRIGGER IF EXISTS ? ON ?`, bun.Ident(table+"_version_trigger"), bun.Ident(table)); err != nil {
+				return err
+			}
+
+			if _, err := db.ExecContext(ctx, `ALTER TABLE ? DROP COLUMN IF EXISTS version`, bun.Ident(table)); err != nil {
+				return err
+			}
+		}
+
+		_, err := db.ExecContext(ctx, `DROP FUNCTION IF EXISTS bump_record_version()`)
+
+		return err
+	})
+}
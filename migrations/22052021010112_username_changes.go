@@ -0,0 +1,48 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/uptrace/bun"
+
+	"github.com/resonatecoop/user-api-template/model"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [up migration] ")
+
+		if _, err := db.ExecContext(ctx, `ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_username varchar`); err != nil {
+			return err
+		}
+
+		_, err := db.NewCreateTable().
+			Model((*model.UsernameChange)(nil)).
+			IfNotExists().
+			ForeignKey(`("user_id") REFERENCES "users" ("id") ON DELETE CASCADE`).
+			Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		if _, err = db.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS username_changes_user_id_idx ON username_changes (user_id, changed_at)`); err != nil {
+			return err
+		}
+
+		_, err = db.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS username_changes_old_username_idx ON username_changes (old_username)`)
+
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [down migration] ")
+
+		if _, err := db.NewDropTable().Model((*model.UsernameChange)(nil)).IfExists().Exec(ctx); err != nil {
+			return err
+		}
+
+		_, err := db.ExecContext(ctx, `ALTER TABLE users DROP COLUMN IF EXISTS pending_username`)
+
+		return err
+	})
+}
@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [up migration] ")
+
+		_, err := db.ExecContext(ctx, `
+      ALTER TABLE users
+      ADD COLUMN IF NOT EXISTS residence_address_id uuid REFERENCES street_addresses (id) ON DELETE SET NULL
+    `)
+
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [down migration] ")
+
+		// residence addresses are only referenced by users
+		if _, err := db.ExecContext(ctx, `
+      DELETE FROM street_addresses WHERE id IN (SELECT residence_address_id FROM users)
+    `); err != nil {
+			return err
+		}
+
+		_, err := db.ExecContext(ctx, `ALTER TABLE users DROP COLUMN IF EXISTS residence_address_id`)
+
+		return err
+	})
+}
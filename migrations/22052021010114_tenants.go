@@ -0,0 +1,59 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/uptrace/bun"
+
+	"github.com/resonatecoop/user-api-template/model"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [up migration] ")
+
+		_, err := db.NewCreateTable().
+			Model((*model.Tenant)(nil)).
+			IfNotExists().
+			Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		// Tenants users already refer to are kept as active tenants named
+		// after their id, to be renamed by an admin
+		_, err = db.ExecContext(ctx, `
+      INSERT INTO tenants (id, name, active, created_at)
+      SELECT DISTINCT tenant_id, 'tenant ' || tenant_id, TRUE, now()
+      FROM users
+      WHERE tenant_id <> 0
+      ON CONFLICT DO NOTHING
+    `)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = db.ExecContext(ctx, `SELECT setval(pg_get_serial_sequence('tenants', 'id'), coalesce(max(id), 0) + 1, false) FROM tenants`)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = db.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS users_tenant_id_idx ON users (tenant_id)`)
+
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [down migration] ")
+
+		if _, err := db.ExecContext(ctx, `DROP INDEX IF EXISTS users_tenant_id_idx`); err != nil {
+			return err
+		}
+
+		_, err := db.NewDropTable().Model((*model.Tenant)(nil)).IfExists().Exec(ctx)
+
+		return err
+	})
+}
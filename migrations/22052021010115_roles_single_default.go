@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [up migration] ")
+
+		// SetDefaultRole swaps the default role, at most one role may be it
+		_, err := db.ExecContext(ctx, `CREATE UNIQUE INDEX IF NOT EXISTS roles_is_default_idx ON roles (is_default) WHERE is_default`)
+
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [down migration] ")
+
+		_, err := db.ExecContext(ctx, `DROP INDEX IF EXISTS roles_is_default_idx`)
+
+		return err
+	})
+}
@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [up migration] ")
+
+		// the role claim of access tokens, apart from their permission scopes
+		_, err := db.ExecContext(ctx, `ALTER TABLE access_tokens ADD COLUMN IF NOT EXISTS role varchar(50)`)
+
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [down migration] ")
+
+		_, err := db.ExecContext(ctx, `ALTER TABLE access_tokens DROP COLUMN IF EXISTS role`)
+
+		return err
+	})
+}
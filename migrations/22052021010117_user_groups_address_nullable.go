@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [up migration] ")
+
+		// groups without an address had an all-zero address_id, they get NULL
+		if _, err := db.ExecContext(ctx, `ALTER TABLE user_groups ALTER COLUMN address_id DROP NOT NULL`); err != nil {
+			return err
+		}
+
+		_, err := db.ExecContext(ctx, `UPDATE user_groups SET address_id = NULL WHERE address_id = uuid_nil()`)
+
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		fmt.Print(" [down migration] ")
+
+		if _, err := db.ExecContext(ctx, `UPDATE user_groups SET address_id = uuid_nil() WHERE address_id IS NULL`); err != nil {
+			return err
+		}
+
+		_, err := db.ExecContext(ctx, `ALTER TABLE user_groups ALTER COLUMN address_id SET NOT NULL`)
+
+		return err
+	})
+}
@@ -3,13 +3,15 @@ package mock
 import (
 	"context"
 
+	uuid "github.com/google/uuid"
+
 	"github.com/resonatecoop/user-api-template/model"
 )
 
 // RBAC Mock
 type RBAC struct {
 	EnforceRoleFn          func(context.Context, model.AccessRole) bool
-	EnforceUserFn          func(context.Context, int64) bool
+	EnforceUserFn          func(context.Context, uuid.UUID) bool
 	EnforceTenantFn        func(context.Context, int32) bool
 	EnforceTenantAdminFn   func(context.Context, int32) bool
 	IsLowerRoleFn          func(context.Context, model.AccessRole) bool
@@ -22,7 +24,7 @@ func (a *RBAC) EnforceRole(c context.Context, role model.AccessRole) bool {
 }
 
 // EnforceUser mock
-func (a *RBAC) EnforceUser(c context.Context, id int64) bool {
+func (a *RBAC) EnforceUser(c context.Context, id uuid.UUID) bool {
 	return a.EnforceUserFn(c, id)
 }
 
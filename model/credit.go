@@ -0,0 +1,58 @@
+package model
+
+import (
+	"time"
+
+	uuid "github.com/google/uuid"
+)
+
+// Credit transaction kinds
+const (
+	CreditTopUp      = "topup"
+	CreditSpend      = "spend"
+	CreditRefund     = "refund"
+	CreditAdjustment = "adjustment"
+)
+
+// Ledger accounts balancing user credit accounts. Every transaction posts one
+// entry to the user's account and an opposite entry to one of these.
+const (
+	CreditAccountTopUps      = "system:topups"
+	CreditAccountSpends      = "system:spends"
+	CreditAccountAdjustments = "system:adjustments"
+)
+
+// CreditAccount holds the running credit balance of a User, which can never
+// go negative
+type CreditAccount struct {
+	UserID    uuid.UUID `bun:"type:uuid,pk"`
+	Balance   int64     `bun:",notnull,default:0"`
+	UpdatedAt time.Time
+}
+
+// CreditTransaction is an immutable posting to a user's credit ledger
+type CreditTransaction struct {
+	ID             uuid.UUID `bun:"type:uuid,default:uuid_generate_v4()"`
+	UserID         uuid.UUID `bun:"type:uuid,notnull"`
+	Kind           string    `bun:"type:varchar(20),notnull"`
+	Amount         int64     `bun:",notnull"` // signed change to the user's balance
+	IdempotencyKey string    `bun:",notnull"`
+	Description    string
+	RefundOf       uuid.UUID `bun:"type:uuid,nullzero"`
+	BalanceAfter   int64     `bun:",notnull"`
+	CreatedAt      time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// CreditEntry is one side of a CreditTransaction. The entries of a
+// transaction always sum to zero.
+type CreditEntry struct {
+	ID            uuid.UUID `bun:"type:uuid,default:uuid_generate_v4()"`
+	TransactionID uuid.UUID `bun:"type:uuid,notnull"`
+	Account       string    `bun:",notnull"`
+	Amount        int64     `bun:",notnull"`
+}
+
+// UserCreditAccount is the ledger account name of a user's credit account
+func UserCreditAccount(userID uuid.UUID) string {
+	return "user:" + userID.String()
+}
@@ -7,6 +7,13 @@ import (
 	uuid "github.com/google/uuid"
 )
 
+// Email token purposes, a token can only be redeemed for the purpose it was issued for
+const (
+	EmailTokenConfirmEmail  = "confirm_email"
+	EmailTokenResetPassword = "reset_password"
+	EmailTokenChangeEmail   = "change_email"
+)
+
 // EmailTokenModel is an abstract model which can be used for objects from which
 // we derive redirect emails (email confirmation, password reset and such)
 type EmailToken struct {
@@ -15,6 +22,9 @@ type EmailToken struct {
 	EmailSent   bool      `bun:",notnull,default:false"`
 	EmailSentAt *time.Time
 	ExpiresAt   time.Time `bun:",notnull"`
+	UserID      uuid.UUID `bun:"type:uuid"`
+	UsedAt      time.Time `bun:",nullzero"`
+	Purpose     string    `bun:"type:varchar(20),notnull"`
 }
 
 type EmailTokenClaims struct {
@@ -22,3 +22,8 @@ type GroupType struct {
 	Name        string `bun:",notnull"`
 	Description string
 }
+
+// PersonaGroupType is the name of the group type of personas, the groups an
+// artist presents themselves as. Other types, like bands and labels, group
+// personas.
+const PersonaGroupType = "persona"
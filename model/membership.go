@@ -0,0 +1,25 @@
+package model
+
+import (
+	"time"
+
+	uuid "github.com/google/uuid"
+)
+
+// Membership statuses. A lapsed membership no longer counts towards
+// User.Member, whatever its period.
+const (
+	MembershipActive = "active"
+	MembershipLapsed = "lapsed"
+)
+
+// Membership is a period of co-op membership of a User in a membership class
+type Membership struct {
+	IDRecord
+	UserID          uuid.UUID `bun:"type:uuid,notnull"`
+	User            *User     `bun:"rel:has-one"`
+	MembershipClass string    `bun:",notnull"`
+	StartsAt        time.Time `bun:",notnull"`
+	EndsAt          time.Time `bun:",notnull"`
+	Status          string    `bun:"type:varchar(20),notnull,default:'active'"`
+}
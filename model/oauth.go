@@ -95,6 +95,7 @@ type AccessToken struct {
 	Token     string    `bun:"type:varchar(40),unique,notnull"`
 	ExpiresAt time.Time `bun:",notnull"`
 	Scope     string    `bun:"type:varchar(200),notnull"`
+	Role      string    `bun:"type:varchar(50),nullzero"` // role claim, the user's role when empty
 }
 
 // // TableName specifies table name
@@ -33,7 +33,7 @@ const (
 type RBACService interface {
 	EnforceRole(context.Context, AccessRole) bool
 	EnforceUser(context.Context, uuid.UUID) bool
-	EnforceTenant(context.Context, uuid.UUID) bool
+	EnforceTenant(context.Context, int32) bool
 	EnforceTenantAdmin(context.Context, int32) bool
 	EnforceTenantAndRole(context.Context, AccessRole, int32) bool
 	IsLowerRole(context.Context, AccessRole) bool
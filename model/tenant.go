@@ -1,10 +1,14 @@
 package model
 
-import uuid "github.com/google/uuid"
+import "time"
 
-// Tenant table
+// Tenant is an organisation users belong to through User.TenantID. A
+// TenantID of 0 means no tenant. Users of an inactive tenant are refused
+// by the API.
 type Tenant struct {
-	Id     uuid.UUID `bun:"type:uuid,default:uuid_generate_v4()"`
-	Name   string    `json:"name"`
-	Active bool      `json:"active"`
+	ID        int32     `bun:",pk,autoincrement"`
+	Name      string    `bun:",notnull,unique"`
+	Active    bool      `bun:",notnull,default:true"`
+	CreatedAt time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+	UpdatedAt time.Time
 }
@@ -20,6 +20,7 @@ type AuthUser struct {
 type User struct {
 	IDRecord
 	Username               string `bun:",notnull,unique"`
+	PendingUsername        string `bun:",nullzero"` // awaiting confirmation before replacing Username
 	FullName               string
 	FirstName              string
 	LastName               string
@@ -27,20 +28,28 @@ type User struct {
 	Country                string `bun:"type:varchar(2)"`
 	Member                 bool   `bun:"default:false,notnull"`
 	NewsletterNotification bool
-	FollowedGroups         []uuid.UUID  `bun:",type:uuid[],array"`
-	OwnerOfGroups          []*UserGroup `bun:"rel:has-many"`
+	FollowedGroups         []uuid.UUID    `bun:",type:uuid[],array"`
+	OwnerOfGroups          []*UserGroup   `bun:"rel:has-many"`
+	ResidenceAddressID     uuid.UUID      `bun:"type:uuid,nullzero"`
+	ResidenceAddress       *StreetAddress `bun:"rel:belongs-to,join:residence_address_id=id"`
 	TenantID               int32
 	RoleID                 int32
 	LastLogin              time.Time
 	LastPasswordChange     time.Time
 	Password               sql.NullString `bun:"type:varchar(60)"`
 	Token                  string
+	AnonymizedAt           time.Time `bun:",nullzero"`
+	Version                int64     `bun:",notnull,default:1"` // bumped by a trigger on every update
 	//	Email                  string `bun:",unique,notnull"`
 	// FavoriteTracks []uuid.UUID `bun:",type:uuid[]" pg:",array"`
 	// Playlists      []uuid.UUID `bun:",type:uuid[]" pg:",array"`
 	// Plays []Track `pg:"many2many:plays"` Payment API
 }
 
+// UserSearchDocument is the text searched by SearchUsers. The full-text and
+// trigram indexes on users are built over this exact expression.
+const UserSearchDocument = "coalesce(username, '') || ' ' || coalesce(full_name, '') || ' ' || coalesce(first_name, '') || ' ' || coalesce(last_name, '')"
+
 // UpdateLoginDetails updates login related fields
 func (u *User) UpdateLoginDetails(token string) {
 	u.Token = token
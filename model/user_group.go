@@ -22,7 +22,7 @@ type UserGroup struct {
 	Description    string
 	ShortBio       string
 	GroupEmail     string
-	AddressID      uuid.UUID `bun:"type:uuid,notnull"` //for Country see User model
+	AddressID      uuid.UUID `bun:"type:uuid,nullzero"` //for Country see User model
 	Address        *StreetAddress
 	TypeID         uuid.UUID `bun:"type:uuid,notnull"` //for e.g. Persona Type
 	Type           *GroupType
@@ -34,6 +34,7 @@ type UserGroup struct {
 	Avatar         uuid.UUID   `bun:"type:uuid"`
 	Banner         uuid.UUID   `bun:"type:uuid"`
 	Tags           []uuid.UUID `bun:",type:uuid[],array"`
+	Version        int64       `bun:",notnull,default:1"` // bumped by a trigger on every update
 	// AdminUsers         []uuid.UUID `bun:",type:uuid[]" pg:",array"`
 	// Followers          []uuid.UUID `bun:",type:uuid[]" pg:",array"`
 	// RecommendedArtists []uuid.UUID `bun:",type:uuid[]" pg:",array"`
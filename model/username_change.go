@@ -0,0 +1,24 @@
+package model
+
+import (
+	"time"
+
+	uuid "github.com/google/uuid"
+)
+
+// How a username change was made
+const (
+	UsernameChangeConfirmed = "confirmed"
+	UsernameChangeAdmin     = "admin"
+)
+
+// UsernameChange records a username a user had before changing it, kept for
+// support and fraud review
+type UsernameChange struct {
+	ID          uuid.UUID `bun:"type:uuid,default:uuid_generate_v4()"`
+	UserID      uuid.UUID `bun:"type:uuid,notnull"`
+	OldUsername string    `bun:",notnull"`
+	NewUsername string    `bun:",notnull"`
+	Source      string    `bun:"type:varchar(20),notnull"`
+	ChangedAt   time.Time `bun:",notnull,default:current_timestamp"`
+}
@@ -1,11 +1,12 @@
 package access
 
 // New instantiates new Access config service
-func New(NoTokenMethods string, PublicMethods string, ReadWriteMethods string) *AccessConfig {
+func New(NoTokenMethods string, PublicMethods string, ReadWriteMethods string, AdminMethods string) *AccessConfig {
 	return &AccessConfig{
 		NoTokenMethods: NoTokenMethods,
 		PublicMethods:  PublicMethods,
 		WriteMethods:   ReadWriteMethods,
+		AdminMethods:   AdminMethods,
 	}
 }
 
@@ -14,5 +15,9 @@ type AccessConfig struct {
 	// Secret key used for signing.
 	NoTokenMethods string
 	PublicMethods  string
-	WriteMethods   string
+	// Deprecated: access tokens need the permission scope of each method
+	// instead, see authorization.MethodScopes
+	WriteMethods string
+	// Methods tenant admins can't access, only AdminRole and above
+	AdminMethods string
 }
@@ -32,6 +32,10 @@ type Configuration struct {
 	App          Application  `yaml:"application,omitempty"`
 	OpenAPI      OpenAPI      `yaml:"openapi,omitempty"`
 	Storage      Storage      `yaml:"storage,omitempty"`
+	Users        Users        `yaml:"users,omitempty"`
+	EmailToken   EmailToken   `yaml:"emailtoken,omitempty"`
+	AuthCache    AuthCache    `yaml:"authcache,omitempty"`
+	JWT          JWT          `yaml:"jwt,omitempty"`
 }
 
 // DatabaseEnv holds dev and test database data
@@ -55,14 +59,47 @@ type Server struct {
 }
 
 type RefreshToken struct {
-	Lifetime int `yaml:"lifetime_seconds,omitempty"`
+	Lifetime       int `yaml:"lifetime_seconds,omitempty"`
+	ExtendInterval int `yaml:"extend_interval_seconds,omitempty"`
+}
+
+// EmailToken holds signing and lifetime configuration for emailed tokens
+type EmailToken struct {
+	SecretKey string `yaml:"secret_key,omitempty"`
+	Lifetime  int    `yaml:"lifetime_seconds,omitempty"`
+}
+
+// AuthCache holds configuration of the cache of tokens, roles and users kept
+// by the auth interceptor, disabled when TTL is 0
+type AuthCache struct {
+	TTL           int `yaml:"ttl_seconds,omitempty"`
+	MaxEntries    int `yaml:"max_entries,omitempty"`
+	StatsInterval int `yaml:"stats_interval_seconds,omitempty"`
+}
+
+// JWT holds the keys and expected issuer and audience of self-contained JWT
+// access tokens, accepted alongside opaque ones once a JWKS file or a key
+// ring directory of <kid>.pem public keys is set
+type JWT struct {
+	JWKSFile   string `yaml:"jwks_file,omitempty"`
+	KeyRingDir string `yaml:"key_ring_dir,omitempty"`
+	Issuer     string `yaml:"issuer,omitempty"`
+	Audience   string `yaml:"audience,omitempty"`
+}
+
+// Users holds user account lifecycle configuration
+type Users struct {
+	DeletionGracePeriod    int `yaml:"deletion_grace_period_seconds,omitempty"`
+	PurgeInterval          int `yaml:"purge_interval_seconds,omitempty"`
+	MembershipSyncInterval int `yaml:"membership_sync_interval_seconds,omitempty"`
 }
 
 // Access holds service access configuration data
 type Access struct {
 	NoTokenMethods string `yaml:"no_token_methods,omitempty"`
 	PublicMethods  string `yaml:"public_methods,omitempty"`
-	WriteMethods   string `yaml:"write_methods,omitempty"`
+	WriteMethods   string `yaml:"write_methods,omitempty"` // deprecated, superseded by permission scopes
+	AdminMethods   string `yaml:"admin_methods,omitempty"`
 }
 
 // Application represents application specific configuration
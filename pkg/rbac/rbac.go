@@ -0,0 +1,63 @@
+package rbac
+
+import (
+	"context"
+
+	uuid "github.com/google/uuid"
+
+	"github.com/resonatecoop/user-api-template/authorization"
+	"github.com/resonatecoop/user-api-template/model"
+)
+
+// Service implements model.RBACService over the AuthUser a request was
+// authenticated as. Requests without one are internal calls, such as those
+// of the command line, and pass every check.
+type Service struct{}
+
+// New creates a new RBAC service
+func New() *Service {
+	return &Service{}
+}
+
+// EnforceRole reports whether the requestor has role r or a higher one
+func (s *Service) EnforceRole(ctx context.Context, r model.AccessRole) bool {
+	authUser := authorization.AuthUserFromContext(ctx)
+
+	return authUser == nil || authUser.Role <= r
+}
+
+// EnforceUser reports whether the requestor may act on the record of user
+// id: their own, or anyone's for tenant admins and higher roles, which tenant
+// checks narrow down further. Labels and artists only act on their own, a
+// role anyone can sign up with mustn't open up other users' records.
+func (s *Service) EnforceUser(ctx context.Context, id uuid.UUID) bool {
+	authUser := authorization.AuthUserFromContext(ctx)
+
+	return authUser == nil || authUser.ID == id || authUser.Role <= model.TenantAdminRole
+}
+
+// EnforceTenant reports whether the requestor may act on tenant id. Admins
+// act on every tenant, everyone else only on their own.
+func (s *Service) EnforceTenant(ctx context.Context, id int32) bool {
+	authUser := authorization.AuthUserFromContext(ctx)
+
+	return authUser == nil || authUser.Role <= model.AdminRole || authUser.TenantID == id
+}
+
+// EnforceTenantAdmin reports whether the requestor administers tenant id
+func (s *Service) EnforceTenantAdmin(ctx context.Context, id int32) bool {
+	return s.EnforceTenantAndRole(ctx, model.TenantAdminRole, id)
+}
+
+// EnforceTenantAndRole reports whether the requestor has role r or a higher
+// one and may act on tenant id
+func (s *Service) EnforceTenantAndRole(ctx context.Context, r model.AccessRole, id int32) bool {
+	return s.EnforceRole(ctx, r) && s.EnforceTenant(ctx, id)
+}
+
+// IsLowerRole reports whether role r is lower than the requestor's
+func (s *Service) IsLowerRole(ctx context.Context, r model.AccessRole) bool {
+	authUser := authorization.AuthUserFromContext(ctx)
+
+	return authUser == nil || authUser.Role < r
+}
@@ -0,0 +1,85 @@
+package rbac_test
+
+import (
+	"context"
+	"testing"
+
+	uuid "github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/resonatecoop/user-api-template/authorization"
+	"github.com/resonatecoop/user-api-template/model"
+	"github.com/resonatecoop/user-api-template/pkg/rbac"
+)
+
+func withUser(role model.AccessRole, tenantID int32) (context.Context, uuid.UUID) {
+	id := uuid.Must(uuid.NewRandom())
+
+	return authorization.ContextWithAuthUser(context.Background(), &model.AuthUser{
+		ID:       id,
+		TenantID: tenantID,
+		Role:     role,
+	}), id
+}
+
+func TestInternalCallsPass(t *testing.T) {
+	s := rbac.New()
+	ctx := context.Background()
+
+	assert.True(t, s.EnforceRole(ctx, model.SuperAdminRole))
+	assert.True(t, s.EnforceUser(ctx, uuid.Must(uuid.NewRandom())))
+	assert.True(t, s.EnforceTenant(ctx, 7))
+	assert.True(t, s.IsLowerRole(ctx, model.SuperAdminRole))
+}
+
+func TestEnforceRole(t *testing.T) {
+	s := rbac.New()
+	ctx, _ := withUser(model.TenantAdminRole, 1)
+
+	assert.True(t, s.EnforceRole(ctx, model.TenantAdminRole))
+	assert.True(t, s.EnforceRole(ctx, model.UserRole))
+	assert.False(t, s.EnforceRole(ctx, model.AdminRole))
+
+	assert.True(t, s.IsLowerRole(ctx, model.LabelRole))
+	assert.False(t, s.IsLowerRole(ctx, model.TenantAdminRole))
+}
+
+func TestEnforceUser(t *testing.T) {
+	s := rbac.New()
+	other := uuid.Must(uuid.NewRandom())
+
+	ctx, id := withUser(model.UserRole, 1)
+
+	assert.True(t, s.EnforceUser(ctx, id))
+	assert.False(t, s.EnforceUser(ctx, other))
+
+	// labels are a role anyone can sign up with
+	ctx, _ = withUser(model.LabelRole, 1)
+
+	assert.False(t, s.EnforceUser(ctx, other))
+
+	ctx, _ = withUser(model.TenantAdminRole, 1)
+
+	assert.True(t, s.EnforceUser(ctx, other))
+}
+
+func TestEnforceTenant(t *testing.T) {
+	s := rbac.New()
+
+	ctx, _ := withUser(model.TenantAdminRole, 1)
+
+	assert.True(t, s.EnforceTenant(ctx, 1))
+	assert.False(t, s.EnforceTenant(ctx, 2))
+	assert.True(t, s.EnforceTenantAdmin(ctx, 1))
+	assert.False(t, s.EnforceTenantAdmin(ctx, 2))
+
+	ctx, _ = withUser(model.ArtistRole, 1)
+
+	assert.False(t, s.EnforceTenantAdmin(ctx, 1))
+	assert.True(t, s.EnforceTenantAndRole(ctx, model.ArtistRole, 1))
+
+	ctx, _ = withUser(model.AdminRole, 1)
+
+	assert.True(t, s.EnforceTenant(ctx, 2))
+	assert.True(t, s.EnforceTenantAdmin(ctx, 2))
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	uuid "github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/resonatecoop/user-api-template/model"
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+)
+
+// addressFields are the keys a residence address may hold
+var addressFields = []string{"line1", "line2", "city", "region", "postal_code", "country"}
+
+var countryCode = regexp.MustCompile("^[A-Z]{2}$")
+
+// postalCodes are the postal code formats of countries that use them,
+// matched against the upper cased code
+var postalCodes = map[string]*regexp.Regexp{
+	"AT": regexp.MustCompile(`^\d{4}$`),
+	"AU": regexp.MustCompile(`^\d{4}$`),
+	"BE": regexp.MustCompile(`^\d{4}$`),
+	"BR": regexp.MustCompile(`^\d{5}-?\d{3}$`),
+	"CA": regexp.MustCompile(`^[A-Z]\d[A-Z] ?\d[A-Z]\d$`),
+	"CH": regexp.MustCompile(`^\d{4}$`),
+	"DE": regexp.MustCompile(`^\d{5}$`),
+	"DK": regexp.MustCompile(`^\d{4}$`),
+	"ES": regexp.MustCompile(`^\d{5}$`),
+	"FR": regexp.MustCompile(`^\d{5}$`),
+	"GB": regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}$`),
+	"IT": regexp.MustCompile(`^\d{5}$`),
+	"JP": regexp.MustCompile(`^\d{3}-?\d{4}$`),
+	"NL": regexp.MustCompile(`^\d{4} ?[A-Z]{2}$`),
+	"NO": regexp.MustCompile(`^\d{4}$`),
+	"NZ": regexp.MustCompile(`^\d{4}$`),
+	"PT": regexp.MustCompile(`^\d{4}-\d{3}$`),
+	"SE": regexp.MustCompile(`^\d{3} ?\d{2}$`),
+	"US": regexp.MustCompile(`^\d{5}(-\d{4})?$`),
+}
+
+// regionCountries need a region, such as a state or province, in addresses
+var regionCountries = map[string]bool{"AU": true, "BR": true, "CA": true, "US": true}
+
+// validateResidenceAddress checks the fields of an address against the rules
+// of its country and returns them normalized. It returns nil for an address
+// without data, which removes a user's address.
+func validateResidenceAddress(address *pbUser.StreetAddress) (map[string]string, error) {
+	data := make(map[string]string, len(address.Data))
+
+	for key, value := range address.Data {
+		if !containsString(addressFields, key) {
+			return nil, status.Errorf(codes.InvalidArgument, "residence_address field %q is not one of %s", key, strings.Join(addressFields, ", "))
+		}
+
+		if value = strings.TrimSpace(value); value != "" {
+			data[key] = value
+		}
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	country := strings.ToUpper(data["country"])
+
+	if !countryCode.MatchString(country) {
+		return nil, status.Errorf(codes.InvalidArgument, "residence_address country must be a two letter country code")
+	}
+
+	data["country"] = country
+
+	for _, key := range []string{"line1", "city"} {
+		if data[key] == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "residence_address %s is required", key)
+		}
+	}
+
+	if regionCountries[country] && data["region"] == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "residence_address region is required in %s", country)
+	}
+
+	if format, ok := postalCodes[country]; ok {
+		postalCode := strings.ToUpper(data["postal_code"])
+
+		if !format.MatchString(postalCode) {
+			return nil, status.Errorf(codes.InvalidArgument, "residence_address postal_code is not valid in %s", country)
+		}
+
+		data["postal_code"] = postalCode
+	}
+
+	return data, nil
+}
+
+// writeResidenceAddress stores data as the residence address of a user,
+// updating the one they have or creating one, without touching their row.
+// It returns the residence_address_id to set along with their other changes,
+// nil when data is nil, so their version is only bumped once, and the address
+// they no longer point at, to delete after that update.
+func writeResidenceAddress(ctx context.Context, tx bun.Tx, userID string, data map[string]string) (interface{}, uuid.UUID, error) {
+	var addressID uuid.UUID
+
+	err := tx.NewSelect().
+		Model((*model.User)(nil)).
+		Column("residence_address_id").
+		Where("id = ?", userID).
+		For("UPDATE").
+		Scan(ctx, &addressID)
+
+	if err != nil {
+		return nil, uuid.Nil, status.Errorf(codes.NotFound, "user not found")
+	}
+
+	if data == nil {
+		return nil, addressID, nil
+	}
+
+	if addressID != uuid.Nil {
+		_, err = tx.NewUpdate().
+			Model((*model.StreetAddress)(nil)).
+			Set("data = ?", data).
+			Where("id = ?", addressID).
+			Exec(ctx)
+
+		return addressID, uuid.Nil, err
+	}
+
+	address, err := insertResidenceAddress(ctx, tx, data)
+
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	return address.ID, uuid.Nil, nil
+}
+
+// insertResidenceAddress stores data as a new personal address
+func insertResidenceAddress(ctx context.Context, tx bun.Tx, data map[string]string) (*model.StreetAddress, error) {
+	address := &model.StreetAddress{
+		ID:           uuid.Must(uuid.NewRandom()),
+		PersonalData: true,
+		Data:         data,
+	}
+
+	if _, err := tx.NewInsert().Model(address).Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	return address, nil
+}
+
+// deleteResidenceAddress detaches and deletes the residence address of a user
+func deleteResidenceAddress(ctx context.Context, tx bun.Tx, userID interface{}, addressID uuid.UUID) error {
+	if addressID == uuid.Nil {
+		return nil
+	}
+
+	_, err := tx.NewUpdate().
+		Model((*model.User)(nil)).
+		Set("residence_address_id = NULL").
+		WhereAllWithDeleted().
+		Where("id = ?", userID).
+		Exec(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return deleteStreetAddress(ctx, tx, addressID)
+}
+
+// deleteStreetAddress deletes an address no user points at any more
+func deleteStreetAddress(ctx context.Context, tx bun.Tx, addressID uuid.UUID) error {
+	if addressID == uuid.Nil {
+		return nil
+	}
+
+	_, err := tx.NewDelete().
+		Model((*model.StreetAddress)(nil)).
+		Where("id = ?", addressID).
+		Exec(ctx)
+
+	return err
+}
+
+// getStreetAddressResponse returns the proto of a loaded address, or nil
+func getStreetAddressResponse(address *model.StreetAddress) *pbUser.StreetAddress {
+	if address == nil || address.ID == uuid.Nil {
+		return nil
+	}
+
+	return &pbUser.StreetAddress{
+		Id:           address.ID.String(),
+		Data:         address.Data,
+		PersonalData: address.PersonalData,
+	}
+}
@@ -0,0 +1,95 @@
+package server_test
+
+import (
+	"github.com/resonatecoop/user-api-template/model"
+
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (suite *UserApiTestSuite) TestResidenceAddress() {
+	ctx := suite.ctx
+
+	// US addresses need a state and a zip code
+	_, err := suite.server.AddUser(ctx, &pbUser.UserAddRequest{
+		Username: "resident@address.com",
+		FullName: "Resident",
+		ResidenceAddress: &pbUser.StreetAddress{Data: map[string]string{
+			"line1":       "1 Main Street",
+			"city":        "Springfield",
+			"country":     "us",
+			"postal_code": "SW1A 1AA",
+		}},
+	})
+	assert.Equal(suite.T(), codes.InvalidArgument, status.Code(err))
+
+	added, err := suite.server.AddUser(ctx, &pbUser.UserAddRequest{
+		Username: "resident@address.com",
+		FullName: "Resident",
+		ResidenceAddress: &pbUser.StreetAddress{Data: map[string]string{
+			"line1":       "10 Downing Street",
+			"city":        "London",
+			"country":     "gb",
+			"postal_code": "sw1a 2aa",
+		}},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	user, err := suite.server.GetUserRestricted(ctx, &pbUser.UserRequest{Id: added.Id})
+	if err != nil {
+		panic(err)
+	}
+
+	if !assert.NotNil(suite.T(), user.ResidenceAddress) {
+		return
+	}
+
+	addressID := user.ResidenceAddress.Id
+
+	assert.Equal(suite.T(), "GB", user.ResidenceAddress.Data["country"])
+	assert.Equal(suite.T(), "SW1A 2AA", user.ResidenceAddress.Data["postal_code"])
+	assert.True(suite.T(), user.ResidenceAddress.PersonalData)
+
+	// an address without data removes it
+	_, err = suite.server.UpdateUser(ctx, &pbUser.UserUpdateRequest{
+		Id:               added.Id,
+		ResidenceAddress: &pbUser.StreetAddress{},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	version := user.Version
+
+	user, err = suite.server.GetUserRestricted(ctx, &pbUser.UserRequest{Id: added.Id})
+	if err != nil {
+		panic(err)
+	}
+	assert.Nil(suite.T(), user.ResidenceAddress)
+
+	// detaching the address is part of the same update
+	assert.Equal(suite.T(), version+1, user.Version)
+
+	count, err := suite.db.NewSelect().
+		Model((*model.StreetAddress)(nil)).
+		Where("id = ?", addressID).
+		Count(ctx)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(suite.T(), 0, count)
+
+	_, err = suite.db.NewDelete().
+		Model((*model.User)(nil)).
+		WhereAllWithDeleted().
+		Where("id = ?", added.Id).
+		ForceDelete().
+		Exec(ctx)
+	if err != nil {
+		panic(err)
+	}
+}
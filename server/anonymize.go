@@ -0,0 +1,264 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	uuid "github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/resonatecoop/user-api-template/model"
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+)
+
+// AnonymizedUsername returns the placeholder username of an anonymized user.
+// It is derived from the user id only, so it stays stable and unique.
+func AnonymizedUsername(id uuid.UUID) string {
+	return fmt.Sprintf("%s@anonymized.invalid", id)
+}
+
+// AnonymizeUser scrubs a user's personal data and revokes their tokens and
+// authorization codes, leaving a tombstone row under the same id. Owned user
+// groups are detached or transferred according to the requested policy.
+func (s *Server) AnonymizeUser(ctx context.Context, req *pbUser.UserAnonymizeRequest) (*pbUser.Empty, error) {
+	id, err := uuid.Parse(req.Id)
+
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "id must be a valid uuid")
+	}
+
+	if err = s.authorizeUser(ctx, s.db, req.Id); err != nil {
+		return nil, err
+	}
+
+	var newOwnerID uuid.UUID
+
+	switch req.GroupPolicy {
+	case pbUser.UserGroupPolicy_DETACH:
+	case pbUser.UserGroupPolicy_TRANSFER:
+		newOwnerID, err = uuid.Parse(req.TransferTo)
+
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "transfer_to must be a valid uuid")
+		}
+
+		if newOwnerID == id {
+			return nil, status.Errorf(codes.InvalidArgument, "transfer_to must be another user")
+		}
+
+		if err = s.authorizeUser(ctx, s.db, req.TransferTo); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown group_policy")
+	}
+
+	err = s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		u := new(model.User)
+
+		err := tx.NewSelect().
+			Model(u).
+			WhereAllWithDeleted().
+			Where("id = ?", id).
+			For("UPDATE").
+			Scan(ctx)
+
+		if err != nil {
+			return status.Errorf(codes.NotFound, "user not found")
+		}
+
+		if !u.AnonymizedAt.IsZero() {
+			return status.Errorf(codes.FailedPrecondition, "user is already anonymized")
+		}
+
+		// groups soft deleted along with their owner would stay deleted, or
+		// be transferred while deleted, once the tombstone is restored
+		if !u.DeletedAt.IsZero() {
+			if err = settleDeletedUserGroups(ctx, tx, u, req.GroupPolicy); err != nil {
+				return err
+			}
+		}
+
+		if req.GroupPolicy == pbUser.UserGroupPolicy_TRANSFER {
+			exists, err := tx.NewSelect().
+				Model((*model.User)(nil)).
+				Where("id = ?", newOwnerID).
+				Where("anonymized_at IS NULL").
+				Exists(ctx)
+
+			if err != nil {
+				return err
+			}
+
+			if !exists {
+				return status.Errorf(codes.NotFound, "transfer_to user not found")
+			}
+
+			_, err = tx.NewUpdate().
+				Model((*model.UserGroup)(nil)).
+				Set("owner_id = ?", newOwnerID).
+				Set("updated_at = ?", time.Now().UTC()).
+				WhereAllWithDeleted().
+				Where("owner_id = ?", id).
+				Exec(ctx)
+
+			if err != nil {
+				return err
+			}
+		} else if err := detachUserGroups(ctx, tx, id); err != nil {
+			return err
+		}
+
+		for _, token := range []interface{}{
+			(*model.AccessToken)(nil),
+			(*model.RefreshToken)(nil),
+			(*model.AuthorizationCode)(nil),
+			(*model.EmailToken)(nil),
+		} {
+			_, err = tx.NewDelete().
+				Model(token).
+				WhereAllWithDeleted().
+				Where("user_id = ?", id).
+				ForceDelete().
+				Exec(ctx)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if err = deleteResidenceAddress(ctx, tx, id, u.ResidenceAddressID); err != nil {
+			return err
+		}
+
+		_, err = tx.NewDelete().
+			Model((*model.UsernameChange)(nil)).
+			Where("user_id = ?", id).
+			Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+
+		// The tombstone is restored if soft deleted so the purge never
+		// removes it and references to the id keep resolving.
+		_, err = tx.NewUpdate().
+			Model((*model.User)(nil)).
+			Set("username = ?", AnonymizedUsername(id)).
+			Set("pending_username = NULL").
+			Set("full_name = ''").
+			Set("first_name = ''").
+			Set("last_name = ''").
+			Set("country = ''").
+			Set("password = NULL").
+			Set("token = ''").
+			Set("email_confirmed = false").
+			Set("newsletter_notification = false").
+			Set("followed_groups = NULL").
+			Set("last_login = NULL").
+			Set("deleted_at = NULL").
+			Set("anonymized_at = ?", now).
+			Set("updated_at = ?", now).
+			WhereAllWithDeleted().
+			Where("id = ?", id).
+			Exec(ctx)
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.InvalidateUser(id)
+
+	return &pbUser.Empty{}, nil
+}
+
+// settleDeletedUserGroups handles the groups soft deleted along with user u.
+// They are restored to be transferred, or purged when detached, as the
+// restored tombstone would keep them from ever being purged.
+func settleDeletedUserGroups(ctx context.Context, tx bun.Tx, u *model.User, policy pbUser.UserGroupPolicy) error {
+	if policy == pbUser.UserGroupPolicy_TRANSFER {
+		_, err := tx.NewUpdate().
+			Model((*model.UserGroup)(nil)).
+			Set("deleted_at = NULL").
+			WhereAllWithDeleted().
+			Where("owner_id = ?", u.ID).
+			Where("deleted_at = ?", u.DeletedAt).
+			Exec(ctx)
+
+		return err
+	}
+
+	var groups []model.UserGroup
+
+	err := tx.NewSelect().
+		Model(&groups).
+		Column("id", "links").
+		WhereDeleted().
+		Where("owner_id = ?", u.ID).
+		Where("deleted_at = ?", u.DeletedAt).
+		Scan(ctx)
+
+	if err != nil || len(groups) == 0 {
+		return err
+	}
+
+	return purgeUserGroups(ctx, tx, groups)
+}
+
+// detachUserGroups keeps the user's groups under the tombstone owner but
+// clears their contact email and removes addresses flagged as personal data
+func detachUserGroups(ctx context.Context, tx bun.Tx, ownerID uuid.UUID) error {
+	var addressIDs []uuid.UUID
+
+	err := tx.NewSelect().
+		Model((*model.UserGroup)(nil)).
+		Column("address_id").
+		WhereAllWithDeleted().
+		Where("owner_id = ?", ownerID).
+		Where("address_id IS NOT NULL").
+		Scan(ctx, &addressIDs)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.NewUpdate().
+		Model((*model.UserGroup)(nil)).
+		Set("group_email = ''").
+		Set("updated_at = ?", time.Now().UTC()).
+		WhereAllWithDeleted().
+		Where("owner_id = ?", ownerID).
+		Exec(ctx)
+
+	if err != nil || len(addressIDs) == 0 {
+		return err
+	}
+
+	_, err = tx.NewUpdate().
+		Model((*model.UserGroup)(nil)).
+		Set("address_id = NULL").
+		WhereAllWithDeleted().
+		Where("owner_id = ?", ownerID).
+		Where("address_id IN (SELECT id FROM street_addresses WHERE personal_data)").
+		Exec(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.NewDelete().
+		Model((*model.StreetAddress)(nil)).
+		Where("id IN (?)", bun.In(addressIDs)).
+		Where("personal_data").
+		Exec(ctx)
+
+	return err
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	uuid "github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/resonatecoop/user-api-template/model"
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+)
+
+// maxBatchUsers is the most users a single batch may change
+const maxBatchUsers = 500
+
+// BatchUpdateUsersRestricted applies one patch to a list of users, or to the
+// users matching a filter, in a single transaction. Each user is changed
+// under its own savepoint, so one failing leaves it unchanged without
+// undoing the others.
+func (s *Server) BatchUpdateUsersRestricted(ctx context.Context, req *pbUser.UserBatchUpdateRestrictedRequest) (*pbUser.UserBatchUpdateResponse, error) {
+	patch := req.Patch
+
+	if patch == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "patch is required")
+	}
+
+	if patch.Member != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "member is derived from memberships, use GrantMembership or LapseMembership")
+	}
+
+	values := make(map[string]interface{})
+
+	if patch.RoleId != nil {
+		exists, err := s.db.NewSelect().
+			Model((*model.Role)(nil)).
+			Where("id = ?", *patch.RoleId).
+			Exists(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !exists {
+			return nil, status.Errorf(codes.InvalidArgument, "role %d does not exist", *patch.RoleId)
+		}
+
+		values["role_id"] = *patch.RoleId
+	}
+	if patch.TenantId != nil {
+		if err := checkTenantExists(ctx, s.db, *patch.TenantId); err != nil {
+			return nil, err
+		}
+
+		values["tenant_id"] = *patch.TenantId
+	}
+	if patch.NewsletterNotification != nil {
+		values["newsletter_notification"] = *patch.NewsletterNotification
+	}
+
+	if patch.Delete && len(values) > 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "delete can't be combined with other changes")
+	}
+
+	if !patch.Delete && len(values) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "patch must change at least one field")
+	}
+
+	ids, err := s.batchUserIDs(ctx, req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	response := new(pbUser.UserBatchUpdateResponse)
+
+	now := time.Now().UTC()
+
+	err = s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		for _, id := range ids {
+			result := &pbUser.UserBatchItemResult{Id: id}
+			response.Results = append(response.Results, result)
+
+			if _, err := uuid.Parse(id); err != nil {
+				result.Error = "id must be a valid uuid"
+				continue
+			}
+
+			if patch.RoleId != nil {
+				if err := s.authorizeRoleChange(ctx, tx, id, *patch.RoleId); err != nil {
+					result.Error = status.Convert(err).Message()
+					continue
+				}
+			}
+
+			if _, err := tx.ExecContext(ctx, "SAVEPOINT batch_user"); err != nil {
+				return err
+			}
+
+			err := batchUpdateUser(ctx, tx, id, values, patch.Delete, now)
+
+			if err != nil {
+				if _, rollbackErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT batch_user"); rollbackErr != nil {
+					return rollbackErr
+				}
+
+				result.Error = status.Convert(err).Message()
+				continue
+			}
+
+			if _, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT batch_user"); err != nil {
+				return err
+			}
+
+			result.Ok = true
+			response.Updated++
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if patch.Delete || patch.RoleId != nil || patch.TenantId != nil {
+		for _, result := range response.Results {
+			if result.Ok {
+				s.invalidateAuthUser(result.Id)
+			}
+		}
+	}
+
+	return response, nil
+}
+
+// batchUpdateUser applies the values of a batch patch to one user, or soft
+// deletes them
+func batchUpdateUser(ctx context.Context, tx bun.Tx, id string, values map[string]interface{}, softDelete bool, now time.Time) error {
+	if softDelete {
+		return softDeleteUser(ctx, tx, id, now)
+	}
+
+	updated := make(map[string]interface{}, len(values)+1)
+
+	for column, value := range values {
+		updated[column] = value
+	}
+
+	updated["updated_at"] = now
+
+	res, err := tx.NewUpdate().
+		Model(&updated).
+		TableExpr("users").
+		Where("id = ?", id).
+		Where("deleted_at IS NULL").
+		Exec(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return status.Errorf(codes.NotFound, "user not found")
+	}
+
+	return nil
+}
+
+// batchUserIDs returns the ids a batch applies to, either as listed without
+// duplicates or as matched by its filter
+func (s *Server) batchUserIDs(ctx context.Context, req *pbUser.UserBatchUpdateRestrictedRequest) ([]string, error) {
+	if len(req.Ids) > 0 {
+		if len(req.Ids) > maxBatchUsers {
+			return nil, status.Errorf(codes.InvalidArgument, "a batch can change at most %d users", maxBatchUsers)
+		}
+
+		seen := make(map[string]bool, len(req.Ids))
+
+		var ids []string
+
+		for _, id := range req.Ids {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+
+		return ids, nil
+	}
+
+	if req.Filter == nil || !hasUserListFilters(req.Filter) {
+		return nil, status.Errorf(codes.InvalidArgument, "ids or a filter narrowing the users is required")
+	}
+
+	var matched []uuid.UUID
+
+	q := s.db.NewSelect().
+		Model((*model.User)(nil)).
+		Column("user.id").
+		OrderExpr("user.id ASC").
+		Limit(maxBatchUsers + 1)
+
+	if err := applyUserListFilters(q, req.Filter); err != nil {
+		return nil, err
+	}
+
+	if err := q.Scan(ctx, &matched); err != nil {
+		return nil, err
+	}
+
+	if len(matched) > maxBatchUsers {
+		return nil, status.Errorf(codes.InvalidArgument, "filter matches more than %d users, narrow it down", maxBatchUsers)
+	}
+
+	ids := make([]string, len(matched))
+
+	for i, id := range matched {
+		ids[i] = id.String()
+	}
+
+	return ids, nil
+}
+
+// hasUserListFilters reports whether any filter of a user list request is set
+func hasUserListFilters(req *pbUser.UserListRequest) bool {
+	return req.RoleId != nil ||
+		req.TenantId != nil ||
+		req.Country != nil ||
+		req.Member != nil ||
+		req.NewsletterNotification != nil ||
+		req.CreatedAfter != "" ||
+		req.CreatedBefore != "" ||
+		req.UpdatedAfter != "" ||
+		req.UpdatedBefore != ""
+}
@@ -0,0 +1,88 @@
+package server_test
+
+import (
+	uuid "github.com/google/uuid"
+	"github.com/resonatecoop/user-api-template/model"
+
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *UserApiTestSuite) TestBatchUpdateUsersRestricted() {
+	ctx := suite.ctx
+
+	var ids []string
+
+	for _, username := range []string{"batch.one@user.com", "batch.two@user.com"} {
+		added, err := suite.server.AddUser(ctx, &pbUser.UserAddRequest{
+			Username: username,
+			FullName: "Batch User",
+		})
+		if err != nil {
+			panic(err)
+		}
+		ids = append(ids, added.Id)
+	}
+
+	newsletter := true
+	member := true
+
+	// member is derived from memberships
+	_, err := suite.server.BatchUpdateUsersRestricted(ctx, &pbUser.UserBatchUpdateRestrictedRequest{
+		Ids:   ids,
+		Patch: &pbUser.UserBatchPatch{Member: &member},
+	})
+	assert.NotNil(suite.T(), err)
+
+	// an empty filter would match everyone
+	_, err = suite.server.BatchUpdateUsersRestricted(ctx, &pbUser.UserBatchUpdateRestrictedRequest{
+		Filter: &pbUser.UserListRequest{},
+		Patch:  &pbUser.UserBatchPatch{NewsletterNotification: &newsletter},
+	})
+	assert.NotNil(suite.T(), err)
+
+	missing := uuid.Must(uuid.NewRandom()).String()
+
+	res, err := suite.server.BatchUpdateUsersRestricted(ctx, &pbUser.UserBatchUpdateRestrictedRequest{
+		Ids:   append([]string{missing}, ids...),
+		Patch: &pbUser.UserBatchPatch{NewsletterNotification: &newsletter},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	// the missing user fails on its own
+	assert.Equal(suite.T(), int32(2), res.Updated)
+	assert.False(suite.T(), res.Results[0].Ok)
+	assert.True(suite.T(), res.Results[1].Ok)
+	assert.True(suite.T(), res.Results[2].Ok)
+
+	count, err := suite.db.NewSelect().
+		Model((*model.User)(nil)).
+		Where("id IN (?, ?)", ids[0], ids[1]).
+		Where("newsletter_notification = TRUE").
+		Count(ctx)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(suite.T(), 2, count)
+
+	res, err = suite.server.BatchUpdateUsersRestricted(ctx, &pbUser.UserBatchUpdateRestrictedRequest{
+		Ids:   ids,
+		Patch: &pbUser.UserBatchPatch{Delete: true},
+	})
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(suite.T(), int32(2), res.Updated)
+
+	_, err = suite.db.NewDelete().
+		Model((*model.User)(nil)).
+		WhereAllWithDeleted().
+		Where("id IN (?, ?)", ids[0], ids[1]).
+		ForceDelete().
+		Exec(ctx)
+	if err != nil {
+		panic(err)
+	}
+}
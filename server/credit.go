@@ -0,0 +1,331 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	uuid "github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/resonatecoop/user-api-template/internal/pkg/pagination"
+	"github.com/resonatecoop/user-api-template/model"
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+)
+
+const (
+	defaultCreditPageSize = 50
+	maxCreditPageSize     = 500
+)
+
+// creditKinds maps request kinds to ledger kinds and their balancing account
+var creditKinds = map[pbUser.CreditTransactionKind]struct {
+	kind    string
+	account string
+}{
+	pbUser.CreditTransactionKind_TOPUP:      {model.CreditTopUp, model.CreditAccountTopUps},
+	pbUser.CreditTransactionKind_SPEND:      {model.CreditSpend, model.CreditAccountSpends},
+	pbUser.CreditTransactionKind_REFUND:     {model.CreditRefund, model.CreditAccountSpends},
+	pbUser.CreditTransactionKind_ADJUSTMENT: {model.CreditAdjustment, model.CreditAccountAdjustments},
+}
+
+// PostCreditTransaction posts a top-up, spend, refund or adjustment to a
+// user's credit ledger. Posting again with the same idempotency key returns
+// the original transaction instead of posting twice.
+func (s *Server) PostCreditTransaction(ctx context.Context, req *pbUser.CreditTransactionRequest) (*pbUser.CreditTransaction, error) {
+	userID, err := uuid.Parse(req.UserId)
+
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id must be a valid uuid")
+	}
+
+	if err = s.authorizeUser(ctx, s.db, req.UserId); err != nil {
+		return nil, err
+	}
+
+	kind, ok := creditKinds[req.Kind]
+
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "kind must be one of TOPUP, SPEND, REFUND or ADJUSTMENT")
+	}
+
+	if req.IdempotencyKey == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "idempotency_key is required")
+	}
+
+	// amount is the signed change to the user's balance
+	amount := req.Amount
+
+	switch req.Kind {
+	case pbUser.CreditTransactionKind_ADJUSTMENT:
+		if amount == 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "amount must not be zero")
+		}
+	case pbUser.CreditTransactionKind_SPEND:
+		if amount <= 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "amount must be positive")
+		}
+		amount = -amount
+	default:
+		if amount <= 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "amount must be positive")
+		}
+	}
+
+	transaction := &model.CreditTransaction{
+		ID:             uuid.Must(uuid.NewRandom()),
+		UserID:         userID,
+		Kind:           kind.kind,
+		Amount:         amount,
+		IdempotencyKey: req.IdempotencyKey,
+		Description:    req.Description,
+		CreatedAt:      time.Now().UTC(),
+	}
+
+	if req.Kind == pbUser.CreditTransactionKind_REFUND {
+		if transaction.RefundOf, err = uuid.Parse(req.RefundOf); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "refund_of must be the id of a spend")
+		}
+	}
+
+	err = s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := checkUserExists(ctx, tx, req.UserId); err != nil {
+			return err
+		}
+
+		// claim the idempotency key first, a concurrent posting with the same
+		// key waits here and then finds the committed transaction
+		res, err := tx.NewInsert().
+			Model(transaction).
+			On("CONFLICT (user_id, idempotency_key) DO NOTHING").
+			Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		if rows, _ := res.RowsAffected(); rows == 0 {
+			return replayCreditTransaction(ctx, tx, transaction)
+		}
+
+		if transaction.Kind == model.CreditRefund {
+			if err := checkRefund(ctx, tx, transaction); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.NewInsert().
+			Model(&model.CreditAccount{UserID: userID}).
+			On("CONFLICT (user_id) DO NOTHING").
+			Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		// the row lock taken by the update serialises concurrent postings,
+		// so a spend can only succeed against the balance it sees
+		res, err = tx.NewUpdate().
+			Model((*model.CreditAccount)(nil)).
+			Set("balance = balance + ?", amount).
+			Set("updated_at = ?", time.Now().UTC()).
+			Where("user_id = ?", userID).
+			Where("balance + ? >= 0", amount).
+			Returning("balance").
+			Exec(ctx, &transaction.BalanceAfter)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return status.Errorf(codes.FailedPrecondition, "insufficient credit")
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if rows, _ := res.RowsAffected(); rows == 0 {
+			return status.Errorf(codes.FailedPrecondition, "insufficient credit")
+		}
+
+		_, err = tx.NewUpdate().
+			Model(transaction).
+			Column("balance_after").
+			WherePK().
+			Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		entries := []model.CreditEntry{
+			{TransactionID: transaction.ID, Account: model.UserCreditAccount(userID), Amount: amount},
+			{TransactionID: transaction.ID, Account: kind.account, Amount: -amount},
+		}
+
+		_, err = tx.NewInsert().
+			Model(&entries).
+			Column("transaction_id", "account", "amount").
+			Exec(ctx)
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return getCreditTransactionResponse(transaction), nil
+}
+
+// replayCreditTransaction loads the transaction already posted under the
+// idempotency key of req into req, provided both describe the same posting
+func replayCreditTransaction(ctx context.Context, tx bun.Tx, req *model.CreditTransaction) error {
+	existing := new(model.CreditTransaction)
+
+	err := tx.NewSelect().
+		Model(existing).
+		Where("user_id = ?", req.UserID).
+		Where("idempotency_key = ?", req.IdempotencyKey).
+		Scan(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if existing.Kind != req.Kind || existing.Amount != req.Amount || existing.RefundOf != req.RefundOf {
+		return status.Errorf(codes.FailedPrecondition, "idempotency_key was already used for a different transaction")
+	}
+
+	*req = *existing
+
+	return nil
+}
+
+// checkRefund makes sure a refund matches a spend of the same user and
+// doesn't take the refunds of that spend over its amount
+func checkRefund(ctx context.Context, tx bun.Tx, refund *model.CreditTransaction) error {
+	spend := new(model.CreditTransaction)
+
+	err := tx.NewSelect().
+		Model(spend).
+		Where("id = ?", refund.RefundOf).
+		Where("user_id = ?", refund.UserID).
+		Where("kind = ?", model.CreditSpend).
+		For("UPDATE").
+		Scan(ctx)
+
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "refund_of must be the id of a spend")
+	}
+
+	var refunded int64
+
+	err = tx.NewSelect().
+		Model((*model.CreditTransaction)(nil)).
+		ColumnExpr("coalesce(sum(amount), 0)").
+		Where("refund_of = ?", spend.ID).
+		Scan(ctx, &refunded)
+
+	if err != nil {
+		return err
+	}
+
+	// refunded already includes this refund
+	if refunded > -spend.Amount {
+		return status.Errorf(codes.FailedPrecondition, "refunds would exceed the amount spent")
+	}
+
+	return nil
+}
+
+// GetUserCredits returns a user's credit balance and a page of their
+// transactions, most recent first
+func (s *Server) GetUserCredits(ctx context.Context, req *pbUser.UserCreditRequest) (*pbUser.UserCreditResponse, error) {
+	userID, err := uuid.Parse(req.Id)
+
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "id must be a valid uuid")
+	}
+
+	if err = s.authorizeUser(ctx, s.db, req.Id); err != nil {
+		return nil, err
+	}
+
+	response := new(pbUser.UserCreditResponse)
+
+	err = s.db.NewSelect().
+		Model((*model.CreditAccount)(nil)).
+		Column("balance").
+		Where("user_id = ?", userID).
+		Scan(ctx, &response.Total)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	pageSize := pagination.PageSize(req.PageSize, defaultCreditPageSize, maxCreditPageSize)
+
+	var transactions []model.CreditTransaction
+
+	q := s.db.NewSelect().
+		Model(&transactions).
+		Where("user_id = ?", userID).
+		Order("created_at DESC", "id DESC").
+		Limit(pageSize + 1)
+
+	if req.PageToken != "" {
+		cursor, err := pagination.Decode(req.PageToken)
+
+		if err != nil || cursor.OrderBy != "credits" {
+			return nil, status.Errorf(codes.InvalidArgument, "page_token is not valid")
+		}
+
+		createdAt, err := time.Parse(time.RFC3339Nano, cursor.Key)
+
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "page_token is not valid")
+		}
+
+		q.Where("(created_at, id) < (?, ?)", createdAt, cursor.ID)
+	}
+
+	if err = q.Scan(ctx); err != nil {
+		return nil, err
+	}
+
+	if len(transactions) > pageSize {
+		transactions = transactions[:pageSize]
+		last := transactions[pageSize-1]
+		response.NextPageToken = pagination.Encode(&pagination.Cursor{
+			OrderBy: "credits",
+			Key:     last.CreatedAt.UTC().Format(time.RFC3339Nano),
+			ID:      last.ID,
+		})
+	}
+
+	for i := range transactions {
+		response.Transactions = append(response.Transactions, getCreditTransactionResponse(&transactions[i]))
+	}
+
+	return response, nil
+}
+
+func getCreditTransactionResponse(transaction *model.CreditTransaction) *pbUser.CreditTransaction {
+	response := &pbUser.CreditTransaction{
+		Id:             transaction.ID.String(),
+		Kind:           transaction.Kind,
+		Amount:         transaction.Amount,
+		BalanceAfter:   transaction.BalanceAfter,
+		IdempotencyKey: transaction.IdempotencyKey,
+		Description:    transaction.Description,
+		CreatedAt:      transaction.CreatedAt.UTC().Format(time.RFC3339),
+	}
+
+	if transaction.RefundOf != uuid.Nil {
+		response.RefundOf = transaction.RefundOf.String()
+	}
+
+	return response
+}
@@ -0,0 +1,133 @@
+package server_test
+
+import (
+	"sync"
+
+	"github.com/resonatecoop/user-api-template/model"
+
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *UserApiTestSuite) TestUserCredits() {
+	ctx := suite.ctx
+
+	added, err := suite.server.AddUser(ctx, &pbUser.UserAddRequest{
+		Username: "credits@me.com",
+		FullName: "Credit Me",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	topUp := &pbUser.CreditTransactionRequest{
+		UserId:         added.Id,
+		Kind:           pbUser.CreditTransactionKind_TOPUP,
+		Amount:         100,
+		IdempotencyKey: "topup-1",
+	}
+
+	first, err := suite.server.PostCreditTransaction(ctx, topUp)
+	if err != nil {
+		panic(err)
+	}
+
+	// posting again with the same key is a no-op
+	again, err := suite.server.PostCreditTransaction(ctx, topUp)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(suite.T(), first.Id, again.Id)
+
+	// reusing the key for another posting is an error
+	_, err = suite.server.PostCreditTransaction(ctx, &pbUser.CreditTransactionRequest{
+		UserId:         added.Id,
+		Kind:           pbUser.CreditTransactionKind_TOPUP,
+		Amount:         50,
+		IdempotencyKey: "topup-1",
+	})
+	assert.NotNil(suite.T(), err)
+
+	// only three of five concurrent spends of 30 fit in a balance of 100
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	var spends []*pbUser.CreditTransaction
+
+	for _, key := range []string{"spend-1", "spend-2", "spend-3", "spend-4", "spend-5"} {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			spend, err := suite.server.PostCreditTransaction(ctx, &pbUser.CreditTransactionRequest{
+				UserId:         added.Id,
+				Kind:           pbUser.CreditTransactionKind_SPEND,
+				Amount:         30,
+				IdempotencyKey: key,
+			})
+			if err == nil {
+				mu.Lock()
+				spends = append(spends, spend)
+				mu.Unlock()
+			}
+		}(key)
+	}
+
+	wg.Wait()
+
+	if !assert.Equal(suite.T(), 3, len(spends)) {
+		return
+	}
+
+	_, err = suite.server.PostCreditTransaction(ctx, &pbUser.CreditTransactionRequest{
+		UserId:         added.Id,
+		Kind:           pbUser.CreditTransactionKind_REFUND,
+		Amount:         30,
+		IdempotencyKey: "refund-1",
+		RefundOf:       spends[0].Id,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	// a spend can't be refunded twice over
+	_, err = suite.server.PostCreditTransaction(ctx, &pbUser.CreditTransactionRequest{
+		UserId:         added.Id,
+		Kind:           pbUser.CreditTransactionKind_REFUND,
+		Amount:         1,
+		IdempotencyKey: "refund-2",
+		RefundOf:       spends[0].Id,
+	})
+	assert.NotNil(suite.T(), err)
+
+	credits, err := suite.server.GetUserCredits(ctx, &pbUser.UserCreditRequest{Id: added.Id, PageSize: 2})
+	if err != nil {
+		panic(err)
+	}
+
+	assert.Equal(suite.T(), int64(40), credits.Total)
+	assert.Equal(suite.T(), 2, len(credits.Transactions))
+	assert.NotEqual(suite.T(), "", credits.NextPageToken)
+
+	// every transaction balances across the ledger
+	var total int64
+
+	err = suite.db.NewSelect().
+		Model((*model.CreditEntry)(nil)).
+		ColumnExpr("coalesce(sum(amount), 0)").
+		Where("transaction_id IN (SELECT id FROM credit_transactions WHERE user_id = ?)", added.Id).
+		Scan(ctx, &total)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(suite.T(), int64(0), total)
+
+	_, err = suite.db.NewDelete().
+		Model((*model.User)(nil)).
+		WhereAllWithDeleted().
+		Where("id = ?", added.Id).
+		ForceDelete().
+		Exec(ctx)
+	if err != nil {
+		panic(err)
+	}
+}
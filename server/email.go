@@ -0,0 +1,203 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	jwt "github.com/form3tech-oss/jwt-go"
+	uuid "github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"google.golang.org/grpc/codes"
+	grpclog "google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/status"
+
+	"github.com/resonatecoop/user-api-template/model"
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+)
+
+const (
+	defaultEmailTokenLifetime = 24 * time.Hour
+
+	// EmailConfirmationTemplate is the template name handed to the MailSender
+	// for email confirmation messages
+	EmailConfirmationTemplate = "email-confirmation"
+)
+
+// MailSender delivers emails rendered from a template. data holds the
+// template values, such as the signed token under "token".
+type MailSender interface {
+	Send(ctx context.Context, email *model.Email, data map[string]string) error
+}
+
+// logMailSender is the default MailSender, it only logs what would be sent
+type logMailSender struct{}
+
+func (logMailSender) Send(ctx context.Context, email *model.Email, data map[string]string) error {
+	grpclog.Infof("[user-api-mail] %s email to %s not sent, no mail sender configured", email.Template, email.Recipient)
+	return nil
+}
+
+// emailTokenLifetime is how long an emailed token can be redeemed
+func (s *Server) emailTokenLifetime() time.Duration {
+	if s.cfg.EmailToken.Lifetime > 0 {
+		return time.Duration(s.cfg.EmailToken.Lifetime) * time.Second
+	}
+	return defaultEmailTokenLifetime
+}
+
+// sendEmailConfirmation emails the user a token confirming their current username
+func (s *Server) sendEmailConfirmation(ctx context.Context, userID uuid.UUID, username string) error {
+	email := model.NewOauthEmail(username, "Confirm your email address", EmailConfirmationTemplate)
+
+	return s.sendEmailToken(ctx, userID, model.EmailTokenConfirmEmail, email)
+}
+
+// sendEmailToken issues an EmailToken for the given purpose, signs it with the
+// recipient as username and hands it to the mail sender
+func (s *Server) sendEmailToken(ctx context.Context, userID uuid.UUID, purpose string, email *model.Email) error {
+	if s.cfg.EmailToken.SecretKey == "" {
+		return errors.New("email token secret key is not configured")
+	}
+
+	lifetime := s.emailTokenLifetime()
+
+	emailToken := model.NewOauthEmailToken(&lifetime)
+	emailToken.ID = uuid.Must(uuid.NewRandom())
+	emailToken.Reference = uuid.Must(uuid.NewRandom())
+	emailToken.UserID = userID
+	emailToken.Purpose = purpose
+
+	_, err := s.db.NewInsert().
+		Column("id", "reference", "email_sent", "expires_at", "user_id", "purpose").
+		Model(emailToken).
+		Exec(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	claims := model.NewOauthEmailTokenClaims(email.Recipient, emailToken)
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.cfg.EmailToken.SecretKey))
+
+	if err != nil {
+		return err
+	}
+
+	if err = s.mailer.Send(ctx, email, map[string]string{"token": signed}); err != nil {
+		return err
+	}
+
+	_, err = s.db.NewUpdate().
+		Model(emailToken).
+		Set("email_sent = TRUE").
+		Set("email_sent_at = ?", time.Now().UTC()).
+		WherePK().
+		Exec(ctx)
+
+	return err
+}
+
+// redeemEmailToken validates a signed token issued for purpose and marks it
+// used within tx. It returns the stored token and its claims.
+func (s *Server) redeemEmailToken(ctx context.Context, tx bun.Tx, token string, purpose string) (*model.EmailToken, *model.EmailTokenClaims, error) {
+	claims := new(model.EmailTokenClaims)
+
+	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(s.cfg.EmailToken.SecretKey), nil
+	})
+
+	if err != nil || s.cfg.EmailToken.SecretKey == "" {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "token is not valid")
+	}
+
+	emailToken := new(model.EmailToken)
+
+	err = tx.NewSelect().
+		Model(emailToken).
+		Where("reference = ?", claims.Reference).
+		Where("purpose = ?", purpose).
+		For("UPDATE").
+		Scan(ctx)
+
+	if err != nil {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "token is not valid")
+	}
+
+	if !emailToken.UsedAt.IsZero() {
+		return nil, nil, status.Errorf(codes.FailedPrecondition, "token has already been used")
+	}
+
+	now := time.Now().UTC()
+
+	if now.After(emailToken.ExpiresAt) {
+		return nil, nil, status.Errorf(codes.FailedPrecondition, "token has expired")
+	}
+
+	_, err = tx.NewUpdate().
+		Model(emailToken).
+		Set("used_at = ?", now).
+		WherePK().
+		Exec(ctx)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return emailToken, claims, nil
+}
+
+// resendEmailConfirmation sends a new confirmation after a username change.
+// Failures are logged, the change itself has already been saved.
+func (s *Server) resendEmailConfirmation(ctx context.Context, id string, username string) {
+	userID, err := uuid.Parse(id)
+
+	if err == nil {
+		err = s.sendEmailConfirmation(ctx, userID, username)
+	}
+
+	if err != nil {
+		grpclog.Errorf("[user-api] sending email confirmation to user %s failed: %v", id, err)
+	}
+}
+
+// ConfirmEmail redeems an email confirmation token, confirming the email of
+// the user it was issued to
+func (s *Server) ConfirmEmail(ctx context.Context, req *pbUser.ConfirmEmailRequest) (*pbUser.Empty, error) {
+	err := s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		emailToken, claims, err := s.redeemEmailToken(ctx, tx, req.Token, model.EmailTokenConfirmEmail)
+
+		if err != nil {
+			return err
+		}
+
+		// the username must not have changed since the token was issued
+		res, err := tx.NewUpdate().
+			Model((*model.User)(nil)).
+			Set("email_confirmed = TRUE").
+			Set("updated_at = ?", time.Now().UTC()).
+			Where("id = ?", emailToken.UserID).
+			Where("username = ?", claims.Username).
+			Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		if rows, _ := res.RowsAffected(); rows == 0 {
+			return status.Errorf(codes.FailedPrecondition, "token does not match the user's current email")
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &pbUser.Empty{}, nil
+}
@@ -0,0 +1,83 @@
+package server_test
+
+import (
+	"context"
+
+	"github.com/resonatecoop/user-api-template/model"
+	"github.com/resonatecoop/user-api-template/server"
+
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingMailSender keeps the template data of every email sent
+type recordingMailSender struct {
+	sent []map[string]string
+}
+
+func (r *recordingMailSender) Send(ctx context.Context, email *model.Email, data map[string]string) error {
+	r.sent = append(r.sent, data)
+	return nil
+}
+
+func (suite *UserApiTestSuite) TestConfirmEmail() {
+	ctx := suite.ctx
+
+	mailer := new(recordingMailSender)
+	srv := server.New(suite.db, suite.cfg, server.WithMailSender(mailer))
+
+	added, err := srv.AddUser(ctx, &pbUser.UserAddRequest{
+		Username: "confirm@me.com",
+		FullName: "Confirm Me",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	if !assert.Equal(suite.T(), 1, len(mailer.sent)) {
+		return
+	}
+
+	_, err = srv.ConfirmEmail(ctx, &pbUser.ConfirmEmailRequest{Token: "not a token"})
+	assert.NotNil(suite.T(), err)
+
+	_, err = srv.ConfirmEmail(ctx, &pbUser.ConfirmEmailRequest{Token: mailer.sent[0]["token"]})
+	if err != nil {
+		panic(err)
+	}
+
+	confirmed := new(model.User)
+
+	err = suite.db.NewSelect().Model(confirmed).Where("id = ?", added.Id).Scan(ctx)
+	if err != nil {
+		panic(err)
+	}
+	assert.True(suite.T(), confirmed.EmailConfirmed)
+
+	// a token can only be redeemed once
+	_, err = srv.ConfirmEmail(ctx, &pbUser.ConfirmEmailRequest{Token: mailer.sent[0]["token"]})
+	assert.NotNil(suite.T(), err)
+
+	// a username changed by an admin needs a new confirmation
+	username := "confirm@again.com"
+
+	_, err = srv.UpdateUserRestricted(ctx, &pbUser.UserUpdateRestrictedRequest{Id: added.Id, Username: &username})
+	if err != nil {
+		panic(err)
+	}
+
+	if assert.Equal(suite.T(), 2, len(mailer.sent)) {
+		_, err = srv.ConfirmEmail(ctx, &pbUser.ConfirmEmailRequest{Token: mailer.sent[1]["token"]})
+		assert.Nil(suite.T(), err)
+	}
+
+	_, err = suite.db.NewDelete().
+		Model((*model.User)(nil)).
+		WhereAllWithDeleted().
+		Where("id = ?", added.Id).
+		ForceDelete().
+		Exec(ctx)
+	if err != nil {
+		panic(err)
+	}
+}
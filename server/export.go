@@ -0,0 +1,539 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	uuid "github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/resonatecoop/user-api-template/model"
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+)
+
+// UserExportVersion is the layout version of UserExport, bump it on any
+// change to the exported fields
+const UserExportVersion = 5
+
+// UserExport is everything held about a user, as handed to them on request
+type UserExport struct {
+	Version         int                      `json:"version"`
+	ExportedAt      time.Time                `json:"exported_at"`
+	User            ExportedUser             `json:"user"`
+	OwnedGroups     []ExportedUserGroup      `json:"owned_groups"`
+	FollowedGroups  []ExportedRelated        `json:"followed_groups"`
+	Memberships     []ExportedMembership     `json:"memberships"`
+	UsernameChanges []ExportedUsernameChange `json:"username_changes"`
+	Credits         ExportedCredits          `json:"credits"`
+	Sessions        ExportedSessions         `json:"sessions"`
+}
+
+// ExportedUser is the user row without credentials
+type ExportedUser struct {
+	ID                     uuid.UUID         `json:"id"`
+	Username               string            `json:"username"`
+	PendingUsername        string            `json:"pending_username,omitempty"`
+	ResidenceAddress       map[string]string `json:"residence_address,omitempty"`
+	FullName               string            `json:"full_name"`
+	FirstName              string            `json:"first_name"`
+	LastName               string            `json:"last_name"`
+	EmailConfirmed         bool              `json:"email_confirmed"`
+	Country                string            `json:"country"`
+	Member                 bool              `json:"member"`
+	NewsletterNotification bool              `json:"newsletter_notification"`
+	TenantID               int32             `json:"tenant_id"`
+	RoleID                 int32             `json:"role_id"`
+	LastLogin              *time.Time        `json:"last_login,omitempty"`
+	LastPasswordChange     *time.Time        `json:"last_password_change,omitempty"`
+	CreatedAt              time.Time         `json:"created_at"`
+	UpdatedAt              *time.Time        `json:"updated_at,omitempty"`
+}
+
+// ExportedUserGroup is an owned user group with its references resolved
+type ExportedUserGroup struct {
+	ID          uuid.UUID         `json:"id"`
+	DisplayName string            `json:"display_name"`
+	GroupType   string            `json:"group_type"`
+	Description string            `json:"description"`
+	ShortBio    string            `json:"short_bio"`
+	GroupEmail  string            `json:"group_email"`
+	Avatar      uuid.UUID         `json:"avatar"`
+	Banner      uuid.UUID         `json:"banner"`
+	Links       []ExportedLink    `json:"links"`
+	Tags        []ExportedTag     `json:"tags"`
+	Address     map[string]string `json:"address,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   *time.Time        `json:"updated_at,omitempty"`
+}
+
+// ExportedLink is a link of an owned user group
+type ExportedLink struct {
+	URI      string `json:"uri"`
+	Platform string `json:"platform"`
+}
+
+// ExportedTag is a tag of an owned user group
+type ExportedTag struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+// ExportedRelated is a user group the user refers to, such as one they follow
+type ExportedRelated struct {
+	ID          uuid.UUID `json:"id"`
+	DisplayName string    `json:"display_name"`
+}
+
+// ExportedMembership is a co-op membership period of the user
+type ExportedMembership struct {
+	MembershipClass string    `json:"membership_class"`
+	Status          string    `json:"status"`
+	StartsAt        time.Time `json:"starts_at"`
+	EndsAt          time.Time `json:"ends_at"`
+}
+
+// ExportedUsernameChange is a previous username of the user
+type ExportedUsernameChange struct {
+	OldUsername string    `json:"old_username"`
+	NewUsername string    `json:"new_username"`
+	Source      string    `json:"source"`
+	ChangedAt   time.Time `json:"changed_at"`
+}
+
+// ExportedCredits is the user's credit balance and full ledger history
+type ExportedCredits struct {
+	Balance      int64                       `json:"balance"`
+	Transactions []ExportedCreditTransaction `json:"transactions"`
+}
+
+// ExportedCreditTransaction is a posting to the user's credit ledger
+type ExportedCreditTransaction struct {
+	Kind         string    `json:"kind"`
+	Amount       int64     `json:"amount"`
+	BalanceAfter int64     `json:"balance_after"`
+	Description  string    `json:"description,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ExportedSessions lists the user's tokens by metadata only, never their values
+type ExportedSessions struct {
+	AccessTokens       []ExportedToken `json:"access_tokens"`
+	RefreshTokens      []ExportedToken `json:"refresh_tokens"`
+	AuthorizationCodes []ExportedToken `json:"authorization_codes"`
+}
+
+// ExportedToken describes an issued token
+type ExportedToken struct {
+	Client    string    `json:"client"`
+	Scope     string    `json:"scope"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ExportUserData returns a copy of all data held about a user as JSON, or as a zip archive holding that JSON
+func (s *Server) ExportUserData(ctx context.Context, req *pbUser.UserExportRequest) (*pbUser.UserExportResponse, error) {
+	if err := s.authorizeUser(ctx, s.db, req.Id); err != nil {
+		return nil, err
+	}
+
+	export, err := s.BuildUserExport(ctx, req.Id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(export, "", "  ")
+
+	if err != nil {
+		return nil, err
+	}
+
+	filename := fmt.Sprintf("user-%s-export.json", export.User.ID)
+	contentType := "application/json"
+
+	if req.Zip {
+		data, err = ZipUserExport(filename, data)
+
+		if err != nil {
+			return nil, err
+		}
+
+		filename = fmt.Sprintf("user-%s-export.zip", export.User.ID)
+		contentType = "application/zip"
+	}
+
+	return &pbUser.UserExportResponse{
+		Version:     UserExportVersion,
+		Filename:    filename,
+		ContentType: contentType,
+		Data:        data,
+	}, nil
+}
+
+// BuildUserExport assembles the export of the user with the supplied id
+func (s *Server) BuildUserExport(ctx context.Context, id string) (*UserExport, error) {
+	u := new(model.User)
+
+	err := s.db.NewSelect().
+		Model(u).
+		Relation("ResidenceAddress").
+		Where("user.id = ?", id).
+		Scan(ctx)
+
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "user not found")
+	}
+
+	export := &UserExport{
+		Version:    UserExportVersion,
+		ExportedAt: time.Now().UTC(),
+		User: ExportedUser{
+			ID:                     u.ID,
+			Username:               u.Username,
+			PendingUsername:        u.PendingUsername,
+			ResidenceAddress:       residenceAddressData(u.ResidenceAddress),
+			FullName:               u.FullName,
+			FirstName:              u.FirstName,
+			LastName:               u.LastName,
+			EmailConfirmed:         u.EmailConfirmed,
+			Country:                u.Country,
+			NewsletterNotification: u.NewsletterNotification,
+			TenantID:               u.TenantID,
+			RoleID:                 u.RoleID,
+			LastLogin:              timeOrNil(u.LastLogin),
+			LastPasswordChange:     timeOrNil(u.LastPasswordChange),
+			CreatedAt:              u.CreatedAt,
+			UpdatedAt:              timeOrNil(u.UpdatedAt),
+		},
+		OwnedGroups:    []ExportedUserGroup{},
+		FollowedGroups: []ExportedRelated{},
+	}
+
+	if export.OwnedGroups, err = s.exportOwnedGroups(ctx, u.ID); err != nil {
+		return nil, err
+	}
+
+	if len(u.FollowedGroups) > 0 {
+		var followed []model.UserGroup
+
+		err = s.db.NewSelect().
+			Model(&followed).
+			Column("id", "display_name").
+			Where("id IN (?)", bun.In(u.FollowedGroups)).
+			Scan(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, group := range followed {
+			export.FollowedGroups = append(export.FollowedGroups, ExportedRelated{ID: group.ID, DisplayName: group.DisplayName})
+		}
+	}
+
+	var memberships []model.Membership
+
+	err = s.db.NewSelect().
+		Model(&memberships).
+		Where("user_id = ?", u.ID).
+		Order("starts_at ASC").
+		Scan(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	for _, membership := range memberships {
+		if membership.Status == model.MembershipActive && !membership.StartsAt.After(now) && membership.EndsAt.After(now) {
+			export.User.Member = true
+		}
+
+		export.Memberships = append(export.Memberships, ExportedMembership{
+			MembershipClass: membership.MembershipClass,
+			Status:          membership.Status,
+			StartsAt:        membership.StartsAt,
+			EndsAt:          membership.EndsAt,
+		})
+	}
+
+	var changes []model.UsernameChange
+
+	err = s.db.NewSelect().
+		Model(&changes).
+		Where("user_id = ?", u.ID).
+		Order("changed_at ASC").
+		Scan(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, change := range changes {
+		export.UsernameChanges = append(export.UsernameChanges, ExportedUsernameChange{
+			OldUsername: change.OldUsername,
+			NewUsername: change.NewUsername,
+			Source:      change.Source,
+			ChangedAt:   change.ChangedAt,
+		})
+	}
+
+	if export.Credits, err = s.exportCredits(ctx, u.ID); err != nil {
+		return nil, err
+	}
+
+	if export.Sessions, err = s.exportSessions(ctx, u.ID); err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+// residenceAddressData returns the fields of a loaded residence address, or nil
+func residenceAddressData(address *model.StreetAddress) map[string]string {
+	if address == nil || address.ID == uuid.Nil {
+		return nil
+	}
+	return address.Data
+}
+
+func (s *Server) exportCredits(ctx context.Context, userID uuid.UUID) (ExportedCredits, error) {
+	var credits ExportedCredits
+
+	err := s.db.NewSelect().
+		Model((*model.CreditAccount)(nil)).
+		Column("balance").
+		Where("user_id = ?", userID).
+		Scan(ctx, &credits.Balance)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return credits, err
+	}
+
+	var transactions []model.CreditTransaction
+
+	err = s.db.NewSelect().
+		Model(&transactions).
+		Where("user_id = ?", userID).
+		Order("created_at ASC", "id ASC").
+		Scan(ctx)
+
+	if err != nil {
+		return credits, err
+	}
+
+	for _, transaction := range transactions {
+		credits.Transactions = append(credits.Transactions, ExportedCreditTransaction{
+			Kind:         transaction.Kind,
+			Amount:       transaction.Amount,
+			BalanceAfter: transaction.BalanceAfter,
+			Description:  transaction.Description,
+			CreatedAt:    transaction.CreatedAt,
+		})
+	}
+
+	return credits, nil
+}
+
+func (s *Server) exportOwnedGroups(ctx context.Context, ownerID uuid.UUID) ([]ExportedUserGroup, error) {
+	var usergroups []model.UserGroup
+
+	err := s.db.NewSelect().
+		Model(&usergroups).
+		Where("owner_id = ?", ownerID).
+		Order("created_at ASC").
+		Scan(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []ExportedUserGroup{}
+
+	for _, usergroup := range usergroups {
+		group := ExportedUserGroup{
+			ID:          usergroup.ID,
+			DisplayName: usergroup.DisplayName,
+			Description: usergroup.Description,
+			ShortBio:    usergroup.ShortBio,
+			GroupEmail:  usergroup.GroupEmail,
+			Avatar:      usergroup.Avatar,
+			Banner:      usergroup.Banner,
+			Links:       []ExportedLink{},
+			Tags:        []ExportedTag{},
+			CreatedAt:   usergroup.CreatedAt,
+			UpdatedAt:   timeOrNil(usergroup.UpdatedAt),
+		}
+
+		groupType := new(model.GroupType)
+
+		err = s.db.NewSelect().
+			Model(groupType).
+			Where("id = ?", usergroup.TypeID).
+			Scan(ctx)
+
+		if err == nil {
+			group.GroupType = groupType.Name
+		}
+
+		if len(usergroup.Links) > 0 {
+			var links []model.Link
+
+			err = s.db.NewSelect().
+				Model(&links).
+				Where("id IN (?)", bun.In(usergroup.Links)).
+				Scan(ctx)
+
+			if err != nil {
+				return nil, err
+			}
+
+			for _, link := range links {
+				group.Links = append(group.Links, ExportedLink{URI: link.URI, Platform: link.Platform})
+			}
+		}
+
+		if len(usergroup.Tags) > 0 {
+			var tags []model.Tag
+
+			err = s.db.NewSelect().
+				Model(&tags).
+				Where("id IN (?)", bun.In(usergroup.Tags)).
+				Scan(ctx)
+
+			if err != nil {
+				return nil, err
+			}
+
+			for _, tag := range tags {
+				group.Tags = append(group.Tags, ExportedTag{Type: tag.Type, Name: tag.Name})
+			}
+		}
+
+		if usergroup.AddressID != uuid.Nil {
+			address := new(model.StreetAddress)
+
+			err = s.db.NewSelect().
+				Model(address).
+				Where("id = ?", usergroup.AddressID).
+				Scan(ctx)
+
+			if err == nil {
+				group.Address = address.Data
+			}
+		}
+
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
+
+func (s *Server) exportSessions(ctx context.Context, userID uuid.UUID) (ExportedSessions, error) {
+	sessions := ExportedSessions{
+		AccessTokens:       []ExportedToken{},
+		RefreshTokens:      []ExportedToken{},
+		AuthorizationCodes: []ExportedToken{},
+	}
+
+	clients := make(map[uuid.UUID]string)
+
+	clientName := func(id uuid.UUID) string {
+		if name, ok := clients[id]; ok {
+			return name
+		}
+
+		client := new(model.Client)
+
+		err := s.db.NewSelect().
+			Model(client).
+			Where("id = ?", id).
+			Scan(ctx)
+
+		if err == nil {
+			clients[id] = client.ApplicationName.String
+		}
+
+		return clients[id]
+	}
+
+	var accessTokens []model.AccessToken
+
+	if err := s.db.NewSelect().Model(&accessTokens).Where("user_id = ?", userID).Order("created_at ASC").Scan(ctx); err != nil {
+		return sessions, err
+	}
+
+	for _, token := range accessTokens {
+		sessions.AccessTokens = append(sessions.AccessTokens, exportedToken(clientName(token.ClientID), token.Scope, token.CreatedAt, token.ExpiresAt))
+	}
+
+	var refreshTokens []model.RefreshToken
+
+	if err := s.db.NewSelect().Model(&refreshTokens).Where("user_id = ?", userID).Order("created_at ASC").Scan(ctx); err != nil {
+		return sessions, err
+	}
+
+	for _, token := range refreshTokens {
+		sessions.RefreshTokens = append(sessions.RefreshTokens, exportedToken(clientName(token.ClientID), token.Scope, token.CreatedAt, token.ExpiresAt))
+	}
+
+	var authorizationCodes []model.AuthorizationCode
+
+	if err := s.db.NewSelect().Model(&authorizationCodes).Where("user_id = ?", userID).Order("created_at ASC").Scan(ctx); err != nil {
+		return sessions, err
+	}
+
+	for _, code := range authorizationCodes {
+		sessions.AuthorizationCodes = append(sessions.AuthorizationCodes, exportedToken(clientName(code.ClientID), code.Scope, code.CreatedAt, code.ExpiresAt))
+	}
+
+	return sessions, nil
+}
+
+func exportedToken(client, scope string, createdAt, expiresAt time.Time) ExportedToken {
+	return ExportedToken{
+		Client:    client,
+		Scope:     scope,
+		CreatedAt: createdAt,
+		ExpiresAt: expiresAt,
+	}
+}
+
+// ZipUserExport wraps an exported JSON document in a zip archive
+func ZipUserExport(filename string, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	archive := zip.NewWriter(&buf)
+
+	f, err := archive.Create(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = f.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err = archive.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
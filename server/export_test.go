@@ -0,0 +1,65 @@
+package server_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/resonatecoop/user-api-template/server"
+
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *UserApiTestSuite) TestExportUserData() {
+	ctx := suite.ctx
+
+	response, err := suite.server.ExportUserData(ctx, &pbUser.UserExportRequest{Id: "f40cf437-eef2-4659-8eb3-7ee93f6dfcea"})
+	if err != nil {
+		panic(err)
+	}
+
+	assert.Equal(suite.T(), "application/json", response.ContentType)
+	assert.Equal(suite.T(), int32(server.UserExportVersion), response.Version)
+
+	export := new(server.UserExport)
+
+	err = json.Unmarshal(response.Data, export)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "test@superuser.com", export.User.Username)
+
+	// credentials are never exported
+	assert.NotContains(suite.T(), string(response.Data), "$2a$10$")
+
+	// the zipped export holds the same document
+	zipped, err := suite.server.ExportUserData(ctx, &pbUser.UserExportRequest{Id: "f40cf437-eef2-4659-8eb3-7ee93f6dfcea", Zip: true})
+	if err != nil {
+		panic(err)
+	}
+
+	assert.Equal(suite.T(), "application/zip", zipped.ContentType)
+
+	archive, err := zip.NewReader(bytes.NewReader(zipped.Data), int64(len(zipped.Data)))
+	if err != nil {
+		panic(err)
+	}
+
+	if assert.Equal(suite.T(), 1, len(archive.File)) {
+		f, err := archive.File[0].Open()
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+
+		data, _ := ioutil.ReadAll(f)
+
+		unzipped := new(server.UserExport)
+
+		assert.Nil(suite.T(), json.Unmarshal(data, unzipped))
+		assert.Equal(suite.T(), export.User, unzipped.User)
+	}
+
+	_, err = suite.server.ExportUserData(ctx, &pbUser.UserExportRequest{Id: "00000000-0000-0000-0000-000000000001"})
+	assert.NotNil(suite.T(), err)
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	uuid "github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/resonatecoop/user-api-template/internal/pkg/pagination"
+	"github.com/resonatecoop/user-api-template/model"
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+)
+
+const (
+	defaultFollowerPageSize = 50
+	maxFollowerPageSize     = 500
+)
+
+// FollowGroup makes a user follow a user group. Following a group twice is a no-op.
+func (s *Server) FollowGroup(ctx context.Context, req *pbUser.UserGroupFollowRequest) (*pbUser.Empty, error) {
+	if _, err := uuid.Parse(req.UserId); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id must be a valid uuid")
+	}
+
+	if err := s.authorizeUser(ctx, s.db, req.UserId); err != nil {
+		return nil, err
+	}
+
+	err := s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		groupIDs, err := validateFollowedGroups(ctx, tx, []string{req.GroupId})
+
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.NewUpdate().
+			Model((*model.User)(nil)).
+			Set("followed_groups = array_append(followed_groups, ?)", groupIDs[0]).
+			Set("updated_at = ?", time.Now().UTC()).
+			Where("id = ?", req.UserId).
+			Where("NOT (coalesce(followed_groups, '{}') @> ?)", pgdialect.Array([]uuid.UUID{groupIDs[0]})).
+			Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		if rows, _ := res.RowsAffected(); rows == 0 {
+			return checkUserExists(ctx, tx, req.UserId)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &pbUser.Empty{}, nil
+}
+
+// UnfollowGroup makes a user stop following a user group. Unfollowing a group
+// that isn't followed is a no-op.
+func (s *Server) UnfollowGroup(ctx context.Context, req *pbUser.UserGroupFollowRequest) (*pbUser.Empty, error) {
+	if _, err := uuid.Parse(req.UserId); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id must be a valid uuid")
+	}
+
+	if err := s.authorizeUser(ctx, s.db, req.UserId); err != nil {
+		return nil, err
+	}
+
+	groupID, err := uuid.Parse(req.GroupId)
+
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "group_id must be a valid uuid")
+	}
+
+	err = s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.NewUpdate().
+			Model((*model.User)(nil)).
+			Set("followed_groups = array_remove(followed_groups, ?)", groupID).
+			Set("updated_at = ?", time.Now().UTC()).
+			Where("id = ?", req.UserId).
+			Where("followed_groups @> ?", pgdialect.Array([]uuid.UUID{groupID})).
+			Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		if rows, _ := res.RowsAffected(); rows == 0 {
+			return checkUserExists(ctx, tx, req.UserId)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &pbUser.Empty{}, nil
+}
+
+// ListGroupFollowers lists a page of the ids of users following a user group,
+// along with the total follower count
+func (s *Server) ListGroupFollowers(ctx context.Context, req *pbUser.GroupFollowersRequest) (*pbUser.GroupFollowersResponse, error) {
+	groupID, err := uuid.Parse(req.Id)
+
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "id must be a valid uuid")
+	}
+
+	count, err := s.followerCount(ctx, groupID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pageSize := pagination.PageSize(req.PageSize, defaultFollowerPageSize, maxFollowerPageSize)
+
+	var followerIDs []uuid.UUID
+
+	q := s.db.NewSelect().
+		Model((*model.User)(nil)).
+		Column("id").
+		Where("followed_groups @> ?", pgdialect.Array([]uuid.UUID{groupID})).
+		OrderExpr("id ASC").
+		Limit(pageSize + 1)
+
+	if req.PageToken != "" {
+		cursor, err := pagination.Decode(req.PageToken)
+
+		if err != nil || cursor.OrderBy != "followers" {
+			return nil, status.Errorf(codes.InvalidArgument, "page_token is not valid")
+		}
+
+		q.Where("id > ?", cursor.ID)
+	}
+
+	if err = q.Scan(ctx, &followerIDs); err != nil {
+		return nil, err
+	}
+
+	response := &pbUser.GroupFollowersResponse{FollowerCount: int64(count)}
+
+	if len(followerIDs) > pageSize {
+		followerIDs = followerIDs[:pageSize]
+		response.NextPageToken = pagination.Encode(&pagination.Cursor{
+			OrderBy: "followers",
+			ID:      followerIDs[pageSize-1],
+		})
+	}
+
+	for _, id := range followerIDs {
+		response.Followers = append(response.Followers, id.String())
+	}
+
+	return response, nil
+}
+
+// followerCount counts the users following a user group
+func (s *Server) followerCount(ctx context.Context, groupID uuid.UUID) (int, error) {
+	return s.db.NewSelect().
+		Model((*model.User)(nil)).
+		Where("followed_groups @> ?", pgdialect.Array([]uuid.UUID{groupID})).
+		Count(ctx)
+}
+
+// validateFollowedGroups parses user group ids, checking each group exists,
+// and returns them without duplicates
+func validateFollowedGroups(ctx context.Context, db bun.IDB, ids []string) ([]uuid.UUID, error) {
+	seen := make(map[uuid.UUID]bool, len(ids))
+
+	var groupIDs []uuid.UUID
+
+	for _, id := range ids {
+		groupID, err := uuid.Parse(id)
+
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "followed group %q is not a valid uuid", id)
+		}
+
+		if !seen[groupID] {
+			seen[groupID] = true
+			groupIDs = append(groupIDs, groupID)
+		}
+	}
+
+	if len(groupIDs) == 0 {
+		return groupIDs, nil
+	}
+
+	count, err := db.NewSelect().
+		Model((*model.UserGroup)(nil)).
+		Where("id IN (?)", bun.In(groupIDs)).
+		Count(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if count != len(groupIDs) {
+		return nil, status.Errorf(codes.NotFound, "user group not found")
+	}
+
+	return groupIDs, nil
+}
+
+// checkUserExists returns a NotFound error unless the user exists
+func checkUserExists(ctx context.Context, db bun.IDB, id string) error {
+	exists, err := db.NewSelect().
+		Model((*model.User)(nil)).
+		Where("id = ?", id).
+		Exists(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return status.Errorf(codes.NotFound, "user not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package server_test
+
+import (
+	"github.com/resonatecoop/user-api-template/model"
+
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (suite *UserApiTestSuite) TestFollowGroups() {
+	ctx := suite.ctx
+
+	owner, err := suite.server.AddUser(ctx, &pbUser.UserAddRequest{
+		Username: "followed.owner@user.com",
+		FullName: "Followed Owner",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	group, err := suite.server.AddUserGroup(ctx, &pbUser.UserGroupCreateRequest{
+		Id:          owner.Id,
+		DisplayName: "Followed Band",
+		GroupType:   "band",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	// users can follow groups as they sign up
+	follower, err := suite.server.AddUser(ctx, &pbUser.UserAddRequest{
+		Username:       "follower@user.com",
+		FullName:       "Follower",
+		FollowedGroups: []string{group.Id},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	other, err := suite.server.AddUser(ctx, &pbUser.UserAddRequest{
+		Username: "other.follower@user.com",
+		FullName: "Other Follower",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	// following twice is a no-op
+	for i := 0; i < 2; i++ {
+		_, err = suite.server.FollowGroup(ctx, &pbUser.UserGroupFollowRequest{UserId: other.Id, GroupId: group.Id})
+		assert.Nil(suite.T(), err)
+	}
+
+	followed, err := suite.server.GetUser(ctx, &pbUser.UserRequest{Id: other.Id})
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(suite.T(), []string{group.Id}, followed.FollowedGroups)
+
+	// one follower per page
+	page, err := suite.server.ListGroupFollowers(ctx, &pbUser.GroupFollowersRequest{Id: group.Id, PageSize: 1})
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(suite.T(), int64(2), page.FollowerCount)
+	assert.Len(suite.T(), page.Followers, 1)
+	assert.NotEmpty(suite.T(), page.NextPageToken)
+
+	next, err := suite.server.ListGroupFollowers(ctx, &pbUser.GroupFollowersRequest{
+		Id:        group.Id,
+		PageSize:  1,
+		PageToken: page.NextPageToken,
+	})
+	if err != nil {
+		panic(err)
+	}
+	assert.ElementsMatch(suite.T(), []string{follower.Id, other.Id}, append(page.Followers, next.Followers...))
+	assert.Empty(suite.T(), next.NextPageToken)
+
+	public, err := suite.server.GetUserGroup(ctx, &pbUser.UserGroupRequest{Id: group.Id})
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(suite.T(), int64(2), public.FollowerCount)
+
+	_, err = suite.server.UnfollowGroup(ctx, &pbUser.UserGroupFollowRequest{UserId: follower.Id, GroupId: group.Id})
+	assert.Nil(suite.T(), err)
+
+	// unfollowing a group that isn't followed is a no-op
+	_, err = suite.server.UnfollowGroup(ctx, &pbUser.UserGroupFollowRequest{UserId: follower.Id, GroupId: group.Id})
+	assert.Nil(suite.T(), err)
+
+	page, err = suite.server.ListGroupFollowers(ctx, &pbUser.GroupFollowersRequest{Id: group.Id})
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(suite.T(), int64(1), page.FollowerCount)
+	assert.Equal(suite.T(), []string{other.Id}, page.Followers)
+
+	// deleted groups can't be followed, at signup or later
+	_, err = suite.server.DeleteUserGroup(ctx, &pbUser.UserGroupRequest{Id: group.Id})
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = suite.server.FollowGroup(ctx, &pbUser.UserGroupFollowRequest{UserId: follower.Id, GroupId: group.Id})
+	assert.Equal(suite.T(), codes.NotFound, status.Code(err))
+
+	_, err = suite.server.AddUser(ctx, &pbUser.UserAddRequest{
+		Username:       "late.follower@user.com",
+		FullName:       "Late Follower",
+		FollowedGroups: []string{group.Id},
+	})
+	assert.Equal(suite.T(), codes.NotFound, status.Code(err))
+
+	_, err = suite.server.FollowGroup(ctx, &pbUser.UserGroupFollowRequest{UserId: follower.Id, GroupId: "not-a-uuid"})
+	assert.Equal(suite.T(), codes.InvalidArgument, status.Code(err))
+
+	_, err = suite.db.NewDelete().
+		Model((*model.UserGroup)(nil)).
+		WhereAllWithDeleted().
+		Where("id = ?", group.Id).
+		ForceDelete().
+		Exec(ctx)
+	if err != nil {
+		panic(err)
+	}
+}
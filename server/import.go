@@ -0,0 +1,523 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	uuid "github.com/google/uuid"
+	grpclog "google.golang.org/grpc/grpclog"
+
+	"github.com/resonatecoop/user-api-template/model"
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+)
+
+// Import formats read by ReadImportRows
+const (
+	ImportCSV   = "csv"
+	ImportJSONL = "jsonl"
+)
+
+// Outcomes of an imported row
+const (
+	ImportCreated = "created"
+	ImportUpdated = "updated"
+	ImportFailed  = "failed"
+)
+
+// importColumns are the columns of a CSV import, in the order of ImportUser.
+// Only username and full_name are required.
+var importColumns = []string{
+	"username",
+	"full_name",
+	"first_name",
+	"last_name",
+	"country",
+	"newsletter_notification",
+	"role_id",
+	"tenant_id",
+}
+
+// ImportUser is a user to create or update in a bulk import. Optional
+// fields are nil when the CSV has no such column or the JSONL object leaves
+// the key out, and updates leave them as they are.
+type ImportUser struct {
+	Username               string  `json:"username"`
+	FullName               string  `json:"full_name"`
+	FirstName              *string `json:"first_name"`
+	LastName               *string `json:"last_name"`
+	Country                *string `json:"country"`
+	NewsletterNotification *bool   `json:"newsletter_notification"`
+	RoleID                 *int32  `json:"role_id"`
+	TenantID               *int32  `json:"tenant_id"`
+}
+
+// ImportRow is a user read from line Line of an import, or the reason it
+// couldn't be read
+type ImportRow struct {
+	Line int
+	User ImportUser
+	Err  error
+}
+
+// ImportOptions control how ImportUsers writes rows. RoleID and TenantID
+// apply to rows that don't set their own. Created users are only sent an
+// email confirmation when SendConfirmation is set.
+type ImportOptions struct {
+	DryRun           bool
+	RoleID           *int32
+	TenantID         *int32
+	SendConfirmation bool
+}
+
+// ImportResult reports the outcome of an imported row
+type ImportResult struct {
+	Line     int
+	Username string
+	Action   string
+	ID       string
+	Error    string
+}
+
+// ReadImportRows reads users from CSV with a header row, or from JSONL with
+// one object per line. Rows that can't be parsed are returned with Err set,
+// only an unreadable input or CSV header fails the whole import.
+func ReadImportRows(r io.Reader, format string) ([]ImportRow, error) {
+	switch format {
+	case ImportCSV:
+		return readImportCSV(r)
+	case ImportJSONL:
+		return readImportJSONL(r)
+	default:
+		return nil, fmt.Errorf("unknown import format %q, expected %s or %s", format, ImportCSV, ImportJSONL)
+	}
+}
+
+func readImportCSV(r io.Reader) ([]ImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+
+	if err != nil {
+		return nil, fmt.Errorf("reading csv header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		if !containsString(importColumns, name) {
+			return nil, fmt.Errorf("unknown csv column %q", name)
+		}
+
+		columns[name] = i
+	}
+
+	for _, name := range []string{"username", "full_name"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("csv column %q is required", name)
+		}
+	}
+
+	var rows []ImportRow
+
+	for {
+		record, err := reader.Read()
+
+		if err == io.EOF {
+			return rows, nil
+		}
+
+		if parseErr, ok := err.(*csv.ParseError); ok {
+			rows = append(rows, ImportRow{Line: parseErr.StartLine, Err: parseErr.Err})
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		row := ImportRow{Line: line}
+		row.User, row.Err = parseImportRecord(record, columns)
+		rows = append(rows, row)
+	}
+}
+
+// parseImportRecord maps a CSV record onto an ImportUser by column name
+func parseImportRecord(record []string, columns map[string]int) (ImportUser, error) {
+	value := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	// columns the file has are set, even when empty
+	optional := func(name string) *string {
+		if _, ok := columns[name]; !ok {
+			return nil
+		}
+		v := value(name)
+		return &v
+	}
+
+	user := ImportUser{
+		Username:  value("username"),
+		FullName:  value("full_name"),
+		FirstName: optional("first_name"),
+		LastName:  optional("last_name"),
+		Country:   optional("country"),
+	}
+
+	if v := value("newsletter_notification"); v != "" {
+		b, err := strconv.ParseBool(v)
+
+		if err != nil {
+			return user, errors.New("newsletter_notification must be true or false")
+		}
+
+		user.NewsletterNotification = &b
+	}
+
+	for name, field := range map[string]**int32{"role_id": &user.RoleID, "tenant_id": &user.TenantID} {
+		if v := value(name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 32)
+
+			if err != nil {
+				return user, fmt.Errorf("%s must be a number", name)
+			}
+
+			id := int32(n)
+			*field = &id
+		}
+	}
+
+	return user, nil
+}
+
+func readImportJSONL(r io.Reader) ([]ImportRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var rows []ImportRow
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+
+		if text == "" {
+			continue
+		}
+
+		row := ImportRow{Line: line}
+
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.DisallowUnknownFields()
+
+		row.Err = decoder.Decode(&row.User)
+
+		rows = append(rows, row)
+	}
+
+	return rows, scanner.Err()
+}
+
+// ImportUsers creates the users of rows that don't exist yet and updates
+// those that do, matching on username. Every row is validated like AddUser
+// and written on its own, so a failed row is reported without aborting the
+// rest. Nothing is written in a dry run.
+func (s *Server) ImportUsers(ctx context.Context, rows []ImportRow, opts ImportOptions) ([]ImportResult, error) {
+	var roleIDs []int32
+
+	err := s.db.NewSelect().
+		Model((*model.Role)(nil)).
+		Column("id").
+		Scan(ctx, &roleIDs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var tenantIDs []int32
+
+	err = s.db.NewSelect().
+		Model((*model.Tenant)(nil)).
+		Column("id").
+		Scan(ctx, &tenantIDs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defaultRole := new(model.Role)
+
+	err = s.db.NewSelect().
+		Model(defaultRole).
+		Where("is_default = TRUE").
+		Scan(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// usernames created earlier in a dry run, which a later row would update
+	planned := make(map[string]bool)
+
+	results := make([]ImportResult, 0, len(rows))
+
+	for _, row := range rows {
+		result := ImportResult{
+			Line:     row.Line,
+			Username: strings.ToLower(row.User.Username),
+		}
+
+		err := row.Err
+
+		if err == nil {
+			err = s.importUser(ctx, row.User, opts, roleIDs, tenantIDs, defaultRole.ID, planned, &result)
+		}
+
+		if err != nil {
+			result.Action = ImportFailed
+			result.Error = err.Error()
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// importUser creates or updates a single imported user, filling in result
+func (s *Server) importUser(
+	ctx context.Context,
+	user ImportUser,
+	opts ImportOptions,
+	roleIDs []int32,
+	tenantIDs []int32,
+	defaultRoleID int32,
+	planned map[string]bool,
+	result *ImportResult,
+) error {
+	if err := checkRequiredAddAttributes(&pbUser.UserAddRequest{Username: user.Username}); err != nil {
+		return err
+	}
+
+	if user.FullName == "" {
+		return errors.New("argument full_name is required")
+	}
+
+	if user.Country != nil && len(*user.Country) > 2 {
+		return errors.New("country must be a two letter code")
+	}
+
+	roleID, tenantID := user.RoleID, user.TenantID
+
+	if roleID == nil {
+		roleID = opts.RoleID
+	}
+
+	if tenantID == nil {
+		tenantID = opts.TenantID
+	}
+
+	if roleID != nil && !containsInt32(roleIDs, *roleID) {
+		return fmt.Errorf("role %d does not exist", *roleID)
+	}
+
+	if tenantID != nil && *tenantID != 0 && !containsInt32(tenantIDs, *tenantID) {
+		return fmt.Errorf("tenant %d does not exist", *tenantID)
+	}
+
+	existing := new(model.User)
+
+	err := s.db.NewSelect().
+		Model(existing).
+		WhereAllWithDeleted().
+		Where("username = ?", result.Username).
+		Scan(ctx)
+
+	found := err == nil
+
+	if !found && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	if found && !existing.DeletedAt.IsZero() {
+		return fmt.Errorf("user %s is deleted, restore it before importing", existing.ID)
+	}
+
+	if found || planned[result.Username] {
+		result.Action = ImportUpdated
+	} else {
+		result.Action = ImportCreated
+	}
+
+	if found {
+		result.ID = existing.ID.String()
+	}
+
+	if opts.DryRun {
+		planned[result.Username] = true
+		return nil
+	}
+
+	if found {
+		values := map[string]interface{}{
+			"full_name":  user.FullName,
+			"updated_at": time.Now().UTC(),
+		}
+
+		if user.FirstName != nil {
+			values["first_name"] = *user.FirstName
+		}
+
+		if user.LastName != nil {
+			values["last_name"] = *user.LastName
+		}
+
+		if user.Country != nil {
+			values["country"] = *user.Country
+		}
+
+		if user.NewsletterNotification != nil {
+			values["newsletter_notification"] = *user.NewsletterNotification
+		}
+
+		if roleID != nil {
+			values["role_id"] = *roleID
+		}
+
+		if tenantID != nil {
+			values["tenant_id"] = *tenantID
+		}
+
+		_, err = s.db.NewUpdate().
+			Model(&values).
+			TableExpr("users").
+			Where("id = ?", existing.ID).
+			Exec(ctx)
+
+		return err
+	}
+
+	newUser := &model.User{
+		Username: result.Username,
+		FullName: user.FullName,
+		RoleID:   defaultRoleID,
+	}
+
+	if user.FirstName != nil {
+		newUser.FirstName = *user.FirstName
+	}
+
+	if user.LastName != nil {
+		newUser.LastName = *user.LastName
+	}
+
+	if user.Country != nil {
+		newUser.Country = *user.Country
+	}
+
+	if user.NewsletterNotification != nil {
+		newUser.NewsletterNotification = *user.NewsletterNotification
+	}
+
+	if roleID != nil {
+		newUser.RoleID = *roleID
+	}
+
+	if tenantID != nil {
+		newUser.TenantID = *tenantID
+	}
+
+	newUser.ID = uuid.Must(uuid.NewRandom())
+
+	_, err = s.db.NewInsert().
+		Column(
+			"id",
+			"username",
+			"full_name",
+			"first_name",
+			"last_name",
+			"role_id",
+			"tenant_id",
+			"country",
+			"newsletter_notification",
+		).
+		Model(newUser).
+		Exec(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	result.ID = newUser.ID.String()
+
+	if !opts.SendConfirmation {
+		return nil
+	}
+
+	if err = s.sendEmailConfirmation(ctx, newUser.ID, newUser.Username); err != nil {
+		grpclog.Errorf("[user-api] sending email confirmation to user %s failed: %v", newUser.ID, err)
+	}
+
+	return nil
+}
+
+// WriteImportReport writes import results as CSV, one line per imported row
+func WriteImportReport(w io.Writer, results []ImportResult) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write([]string{"line", "username", "action", "id", "error"}); err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		err := writer.Write([]string{
+			strconv.Itoa(result.Line),
+			result.Username,
+			result.Action,
+			result.ID,
+			result.Error,
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt32(values []int32, value int32) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package server_test
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/resonatecoop/user-api-template/model"
+	"github.com/resonatecoop/user-api-template/server"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *UserApiTestSuite) TestImportUsers() {
+	ctx := suite.ctx
+
+	csv := `username,full_name,country,newsletter_notification
+import.one@label.com,Import One,GB,true
+not-an-email,Bad Row,,
+import.two@label.com,Import Two,,maybe
+import.one@label.com,Import One Again,FR,
+`
+
+	rows, err := server.ReadImportRows(strings.NewReader(csv), server.ImportCSV)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(suite.T(), 4, len(rows))
+
+	// a dry run reports the outcome of every row without writing
+	results, err := suite.server.ImportUsers(ctx, rows, server.ImportOptions{DryRun: true})
+	if err != nil {
+		panic(err)
+	}
+
+	actions := make([]string, len(results))
+	for i, result := range results {
+		actions[i] = result.Action
+	}
+	assert.Equal(suite.T(), []string{
+		server.ImportCreated,
+		server.ImportFailed,
+		server.ImportFailed,
+		server.ImportUpdated,
+	}, actions)
+	assert.Equal(suite.T(), 3, results[1].Line)
+
+	exists, err := suite.db.NewSelect().
+		Model((*model.User)(nil)).
+		Where("username = ?", "import.one@label.com").
+		Exists(ctx)
+	if err != nil {
+		panic(err)
+	}
+	assert.False(suite.T(), exists)
+
+	results, err = suite.server.ImportUsers(ctx, rows, server.ImportOptions{})
+	if err != nil {
+		panic(err)
+	}
+
+	// the second row for the same username updates the first
+	imported := new(model.User)
+
+	err = suite.db.NewSelect().
+		Model(imported).
+		Where("username = ?", "import.one@label.com").
+		Scan(ctx)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(suite.T(), "Import One Again", imported.FullName)
+	assert.Equal(suite.T(), "FR", imported.Country)
+	assert.True(suite.T(), imported.NewsletterNotification)
+	assert.Equal(suite.T(), imported.ID.String(), results[3].ID)
+
+	// confirmations are opt-in for imports
+	sent, err := suite.db.NewSelect().
+		Model((*model.EmailToken)(nil)).
+		Where("user_id = ?", imported.ID).
+		Exists(ctx)
+	if err != nil {
+		panic(err)
+	}
+	assert.False(suite.T(), sent)
+
+	var report bytes.Buffer
+
+	if err = server.WriteImportReport(&report, results); err != nil {
+		panic(err)
+	}
+	assert.Equal(suite.T(), 5, strings.Count(report.String(), "\n"))
+
+	// columns and keys a row leaves out are not updated
+	for _, input := range []struct {
+		format string
+		data   string
+	}{
+		{server.ImportCSV, "username,full_name\nimport.one@label.com,Import One Csv\n"},
+		{server.ImportJSONL, `{"username":"import.one@label.com","full_name":"Import One Jsonl"}` + "\n"},
+	} {
+		rows, err = server.ReadImportRows(strings.NewReader(input.data), input.format)
+		if err != nil {
+			panic(err)
+		}
+
+		_, err = suite.server.ImportUsers(ctx, rows, server.ImportOptions{})
+		if err != nil {
+			panic(err)
+		}
+
+		updated := new(model.User)
+
+		err = suite.db.NewSelect().
+			Model(updated).
+			Where("id = ?", imported.ID).
+			Scan(ctx)
+		if err != nil {
+			panic(err)
+		}
+		assert.Equal(suite.T(), "FR", updated.Country)
+		assert.True(suite.T(), updated.NewsletterNotification)
+	}
+
+	_, err = suite.db.NewDelete().
+		Model((*model.User)(nil)).
+		WhereAllWithDeleted().
+		Where("id = ?", imported.ID).
+		ForceDelete().
+		Exec(ctx)
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,269 @@
+package server_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	jwt "github.com/form3tech-oss/jwt-go"
+	uuid "github.com/google/uuid"
+	"github.com/resonatecoop/user-api-template/authorization"
+	"github.com/resonatecoop/user-api-template/model"
+	"github.com/resonatecoop/user-api-template/pkg/access"
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func (suite *UserApiTestSuite) TestAuthInterceptor() {
+	ctx := suite.ctx
+
+	tenantAdmin := uuid.MustParse("243b4178-6f98-4bf1-bbb1-46b57a901816")
+	artist := uuid.MustParse("5253747c-2b8c-40e2-8a70-bab91348a9bd")
+
+	acc := access.New(
+		"/user.ResonateUser/AddUser",
+		"/user.ResonateUser/GetUser",
+		"",
+		"/user.ResonateUser/CreateTenant",
+	)
+
+	interceptor := authorization.NewAuthInterceptor(
+		suite.db,
+		authorization.NewRefreshExtender(suite.db, time.Hour, time.Hour),
+		acc,
+		nil,
+		nil,
+	).Unary()
+
+	addToken := func(token string, userID uuid.UUID, scope string, role string) {
+		_, err := suite.db.NewInsert().
+			Model(&model.AccessToken{
+				ClientID:  uuid.MustParse("3392e754-ba3e-424f-a687-add9a8ab39c9"),
+				UserID:    userID,
+				Token:     token,
+				ExpiresAt: time.Now().UTC().Add(time.Hour),
+				Scope:     scope,
+				Role:      role,
+			}).
+			Exec(ctx)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// call runs method through the interceptor with token, returning the
+	// AuthUser the handler was called with
+	call := func(token string, method string) (*model.AuthUser, error) {
+		callCtx := ctx
+
+		if token != "" {
+			callCtx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+token))
+		}
+
+		var authUser *model.AuthUser
+
+		_, err := interceptor(callCtx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			authUser = authorization.AuthUserFromContext(ctx)
+			return nil, nil
+		})
+
+		return authUser, err
+	}
+
+	// methods that need no token skip the checks
+	authUser, err := call("", "/user.ResonateUser/AddUser")
+	assert.Nil(suite.T(), err)
+	assert.Nil(suite.T(), authUser)
+
+	_, err = call("", "/user.ResonateUser/GetUser")
+	assert.Equal(suite.T(), codes.Unauthenticated, status.Code(err))
+
+	_, err = call("unknown_token", "/user.ResonateUser/GetUser")
+	assert.Equal(suite.T(), codes.Unauthenticated, status.Code(err))
+
+	// a token without scopes grants nothing
+	addToken("interceptor_no_scope", artist, "", "")
+
+	_, err = call("interceptor_no_scope", "/user.ResonateUser/GetUser")
+	assert.Equal(suite.T(), codes.PermissionDenied, status.Code(err))
+	assert.Equal(suite.T(), "access token is missing scope users:read required by method /user.ResonateUser/GetUser", status.Convert(err).Message())
+
+	// without a role claim the token has the user's role
+	addToken("interceptor_artist", artist, "users:read", "")
+
+	authUser, err = call("interceptor_artist", "/user.ResonateUser/GetUser")
+	if assert.Nil(suite.T(), err) {
+		assert.Equal(suite.T(), artist, authUser.ID)
+		assert.Equal(suite.T(), model.ArtistRole, authUser.Role)
+	}
+
+	// scopes that name no role, like those of OIDC, leave the user's role
+	addToken("interceptor_oidc", artist, "users:read openid profile", "")
+
+	authUser, err = call("interceptor_oidc", "/user.ResonateUser/GetUser")
+	if assert.Nil(suite.T(), err) {
+		assert.Equal(suite.T(), model.ArtistRole, authUser.Role)
+	}
+
+	// only tenant admins and above get past public methods
+	_, err = call("interceptor_artist", "/user.ResonateUser/ListUsers")
+	assert.Equal(suite.T(), codes.PermissionDenied, status.Code(err))
+	assert.Equal(suite.T(), "requestor is not authorized for this method", status.Convert(err).Message())
+
+	// a role claim can't raise the user's role
+	addToken("interceptor_raised", artist, "users:read", "superadmin")
+
+	authUser, err = call("interceptor_raised", "/user.ResonateUser/GetUser")
+	if assert.Nil(suite.T(), err) {
+		assert.Equal(suite.T(), model.ArtistRole, authUser.Role)
+	}
+
+	// but it can lower it
+	addToken("interceptor_lowered", tenantAdmin, "users:read", "user")
+
+	authUser, err = call("interceptor_lowered", "/user.ResonateUser/GetUser")
+	if assert.Nil(suite.T(), err) {
+		assert.Equal(suite.T(), model.UserRole, authUser.Role)
+	}
+
+	_, err = call("interceptor_lowered", "/user.ResonateUser/ListUsers")
+	assert.Equal(suite.T(), codes.PermissionDenied, status.Code(err))
+
+	// tenant admins reach non public methods, but not those reserved to admins
+	addToken("interceptor_tenant_admin", tenantAdmin, "users:read tenants:write", "")
+
+	authUser, err = call("interceptor_tenant_admin", "/user.ResonateUser/ListUsers")
+	if assert.Nil(suite.T(), err) {
+		assert.Equal(suite.T(), model.TenantAdminRole, authUser.Role)
+	}
+
+	_, err = call("interceptor_tenant_admin", "/user.ResonateUser/CreateTenant")
+	assert.Equal(suite.T(), codes.PermissionDenied, status.Code(err))
+
+	// the legacy read scope grants every read permission and no write one
+	addToken("interceptor_legacy", tenantAdmin, "read", "")
+
+	_, err = call("interceptor_legacy", "/user.ResonateUser/ListUsers")
+	assert.Nil(suite.T(), err)
+
+	_, err = call("interceptor_legacy", "/user.ResonateUser/DeleteUser")
+	assert.Equal(suite.T(), codes.PermissionDenied, status.Code(err))
+	assert.Equal(suite.T(), "access token is missing scope users:write required by method /user.ResonateUser/DeleteUser", status.Convert(err).Message())
+}
+
+func (suite *UserApiTestSuite) TestAuthInterceptorJWT() {
+	ctx := suite.ctx
+
+	artist := uuid.MustParse("5253747c-2b8c-40e2-8a70-bab91348a9bd")
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		panic(err)
+	}
+
+	dir := suite.T().TempDir()
+
+	err = ioutil.WriteFile(filepath.Join(dir, "test.pem"), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600)
+	if err != nil {
+		panic(err)
+	}
+
+	verifier, err := authorization.NewJWTVerifier("", dir, "", "")
+	if err != nil {
+		panic(err)
+	}
+
+	interceptor := authorization.NewAuthInterceptor(
+		suite.db,
+		authorization.NewRefreshExtender(suite.db, time.Hour, time.Hour),
+		access.New("", "/user.ResonateUser/GetUser", "", ""),
+		nil,
+		verifier,
+	).Unary()
+
+	call := func(claims jwt.MapClaims) (*model.AuthUser, error) {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+
+		token, err := jwt.NewWithClaims(authorization.SigningMethodEdDSA, claims).SignedString(private)
+		if err != nil {
+			panic(err)
+		}
+
+		callCtx := metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+token))
+
+		var authUser *model.AuthUser
+
+		_, err = interceptor(callCtx, nil, &grpc.UnaryServerInfo{FullMethod: "/user.ResonateUser/GetUser"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			authUser = authorization.AuthUserFromContext(ctx)
+			return nil, nil
+		})
+
+		return authUser, err
+	}
+
+	// the user is looked up, their claims can't raise their role or move
+	// them to another tenant
+	authUser, err := call(jwt.MapClaims{"sub": artist.String(), "scope": "users:read", "role": "superadmin", "tenant_id": 7})
+	if assert.Nil(suite.T(), err) {
+		assert.Equal(suite.T(), model.ArtistRole, authUser.Role)
+		assert.Equal(suite.T(), int32(0), authUser.TenantID)
+		assert.Equal(suite.T(), "miles@davis.com", authUser.Username)
+	}
+
+	// without a role claim the token has the user's role
+	authUser, err = call(jwt.MapClaims{"sub": artist.String(), "scope": "users:read"})
+	if assert.Nil(suite.T(), err) {
+		assert.Equal(suite.T(), model.ArtistRole, authUser.Role)
+	}
+
+	_, err = call(jwt.MapClaims{"sub": uuid.New().String(), "scope": "users:read", "role": "user"})
+	assert.Equal(suite.T(), codes.PermissionDenied, status.Code(err))
+
+	// users of an inactive tenant are refused
+	tenant, err := suite.server.CreateTenant(ctx, &pbUser.TenantCreateRequest{Name: "JWT Tenant"})
+	if err != nil {
+		panic(err)
+	}
+
+	defer suite.db.NewDelete().
+		Model((*model.Tenant)(nil)).
+		Where("id = ?", tenant.Id).
+		Exec(ctx)
+
+	added, err := suite.server.AddUser(ctx, &pbUser.UserAddRequest{
+		Username: "jwt.user@user.com",
+		FullName: "JWT User",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = suite.server.UpdateUserRestricted(ctx, &pbUser.UserUpdateRestrictedRequest{Id: added.Id, TenantId: &tenant.Id})
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = suite.server.DeactivateTenant(ctx, &pbUser.TenantRequest{Id: tenant.Id})
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = call(jwt.MapClaims{"sub": added.Id, "scope": "users:read"})
+	assert.Equal(suite.T(), codes.PermissionDenied, status.Code(err))
+	assert.Equal(suite.T(), "tenant of requestor is inactive", status.Convert(err).Message())
+}
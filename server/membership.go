@@ -0,0 +1,357 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	uuid "github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"google.golang.org/grpc/codes"
+	grpclog "google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/status"
+
+	"github.com/resonatecoop/user-api-template/model"
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+)
+
+const defaultMembershipSyncInterval = time.Hour
+
+// activeMembershipExpr is true when the user in the outer query has a
+// membership that is active and currently within its period
+const activeMembershipExpr = `EXISTS (
+  SELECT 1 FROM memberships AS m
+  WHERE m.user_id = "user"."id" AND m.status = 'active' AND m.deleted_at IS NULL
+  AND m.starts_at <= now() AND m.ends_at > now()
+)`
+
+// membershipSyncInterval is how often RunMembershipSync refreshes User.Member
+func (s *Server) membershipSyncInterval() time.Duration {
+	if s.cfg.Users.MembershipSyncInterval > 0 {
+		return time.Duration(s.cfg.Users.MembershipSyncInterval) * time.Second
+	}
+	return defaultMembershipSyncInterval
+}
+
+// RunMembershipSync keeps User.Member in line with membership periods as they
+// start and end, once per configured interval, until ctx is cancelled.
+func (s *Server) RunMembershipSync(ctx context.Context) {
+	ticker := time.NewTicker(s.membershipSyncInterval())
+	defer ticker.Stop()
+
+	for {
+		synced, err := s.SyncMembers(ctx)
+
+		if err != nil {
+			grpclog.Errorf("[user-api-membership] sync failed: %v", err)
+		} else if synced > 0 {
+			grpclog.Infof("[user-api-membership] updated member status of %d users", synced)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SyncMembers sets User.Member from active memberships for every user whose
+// status is out of date and returns how many were updated
+func (s *Server) SyncMembers(ctx context.Context) (int, error) {
+	res, err := s.db.NewUpdate().
+		Model((*model.User)(nil)).
+		Set("member = "+activeMembershipExpr).
+		Set("updated_at = ?", time.Now().UTC()).
+		Where(`"user"."member" IS DISTINCT FROM ` + activeMembershipExpr).
+		Exec(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	rows, _ := res.RowsAffected()
+
+	return int(rows), nil
+}
+
+// syncMember sets User.Member of a single user from their active memberships
+func syncMember(ctx context.Context, tx bun.Tx, userID uuid.UUID) error {
+	_, err := tx.NewUpdate().
+		Model((*model.User)(nil)).
+		Set("member = "+activeMembershipExpr).
+		Set("updated_at = ?", time.Now().UTC()).
+		Where(`"user"."id" = ?`, userID).
+		Exec(ctx)
+
+	return err
+}
+
+// loadActiveMembers returns which of the supplied users have a membership
+// active right now. Reads use it rather than the stored User.Member, which
+// only catches up with periods starting and ending on the next sync.
+func loadActiveMembers(ctx context.Context, db bun.IDB, userIDs []uuid.UUID) (map[uuid.UUID]bool, error) {
+	members := make(map[uuid.UUID]bool, len(userIDs))
+
+	if len(userIDs) == 0 {
+		return members, nil
+	}
+
+	var active []uuid.UUID
+
+	err := db.NewSelect().
+		Model((*model.Membership)(nil)).
+		ColumnExpr("DISTINCT membership.user_id").
+		Where("membership.user_id IN (?)", bun.In(userIDs)).
+		Where("membership.status = ?", model.MembershipActive).
+		Where("membership.starts_at <= now() AND membership.ends_at > now()").
+		Scan(ctx, &active)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range active {
+		members[id] = true
+	}
+
+	return members, nil
+}
+
+// setPrivateMembers fills in the member status of a page of user responses
+// with a single query
+func setPrivateMembers(ctx context.Context, db bun.IDB, users []*pbUser.UserPrivateResponse) error {
+	userIDs := make([]uuid.UUID, 0, len(users))
+
+	for _, user := range users {
+		if id, err := uuid.Parse(user.Id); err == nil {
+			userIDs = append(userIDs, id)
+		}
+	}
+
+	members, err := loadActiveMembers(ctx, db, userIDs)
+
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		if id, err := uuid.Parse(user.Id); err == nil {
+			user.Member = members[id]
+		}
+	}
+
+	return nil
+}
+
+// GrantMembership starts a new membership period for a user
+func (s *Server) GrantMembership(ctx context.Context, req *pbUser.UserMembershipGrantRequest) (*pbUser.UserMembershipResponse, error) {
+	userID, err := uuid.Parse(req.UserId)
+
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "user_id must be a valid uuid")
+	}
+
+	if err = s.authorizeUser(ctx, s.db, req.UserId); err != nil {
+		return nil, err
+	}
+
+	if req.MembershipClass == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "membership_class is required")
+	}
+
+	startsAt := time.Now().UTC()
+
+	if req.Start != "" {
+		if startsAt, err = time.Parse(time.RFC3339, req.Start); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "start must be an RFC 3339 timestamp")
+		}
+	}
+
+	endsAt, err := time.Parse(time.RFC3339, req.End)
+
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "end must be an RFC 3339 timestamp")
+	}
+
+	if !endsAt.After(startsAt) {
+		return nil, status.Errorf(codes.InvalidArgument, "end must be after start")
+	}
+
+	membership := &model.Membership{
+		UserID:          userID,
+		MembershipClass: req.MembershipClass,
+		StartsAt:        startsAt.UTC(),
+		EndsAt:          endsAt.UTC(),
+		Status:          model.MembershipActive,
+	}
+
+	membership.ID = uuid.Must(uuid.NewRandom())
+	membership.UpdatedAt = time.Now().UTC()
+
+	err = s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := checkUserExists(ctx, tx, req.UserId); err != nil {
+			return err
+		}
+
+		_, err := tx.NewInsert().
+			Column("id", "user_id", "membership_class", "starts_at", "ends_at", "status", "updated_at").
+			Model(membership).
+			Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		return syncMember(ctx, tx, userID)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return getMembershipResponse(membership), nil
+}
+
+// RenewMembership extends a membership period to a later end, reactivating it
+// if it had lapsed
+func (s *Server) RenewMembership(ctx context.Context, req *pbUser.UserMembershipRenewRequest) (*pbUser.UserMembershipResponse, error) {
+	endsAt, err := time.Parse(time.RFC3339, req.End)
+
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "end must be an RFC 3339 timestamp")
+	}
+
+	membership := new(model.Membership)
+
+	err = s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewSelect().
+			Model(membership).
+			Where("id = ?", req.Id).
+			For("UPDATE").
+			Scan(ctx)
+
+		if err != nil {
+			return status.Errorf(codes.NotFound, "membership not found")
+		}
+
+		if err = s.authorizeUser(ctx, tx, membership.UserID.String()); err != nil {
+			return err
+		}
+
+		if !endsAt.After(membership.EndsAt) {
+			return status.Errorf(codes.InvalidArgument, "end must be after the current end of the membership")
+		}
+
+		membership.EndsAt = endsAt.UTC()
+		membership.Status = model.MembershipActive
+		membership.UpdatedAt = time.Now().UTC()
+
+		_, err = tx.NewUpdate().
+			Model(membership).
+			Column("ends_at", "status", "updated_at").
+			WherePK().
+			Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		return syncMember(ctx, tx, membership.UserID)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return getMembershipResponse(membership), nil
+}
+
+// LapseMembership ends a membership now, or at its end if that is earlier
+func (s *Server) LapseMembership(ctx context.Context, req *pbUser.UserMembershipRequest) (*pbUser.UserMembershipResponse, error) {
+	membership := new(model.Membership)
+
+	err := s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewSelect().
+			Model(membership).
+			Where("id = ?", req.Id).
+			For("UPDATE").
+			Scan(ctx)
+
+		if err != nil {
+			return status.Errorf(codes.NotFound, "membership not found")
+		}
+
+		if err = s.authorizeUser(ctx, tx, membership.UserID.String()); err != nil {
+			return err
+		}
+
+		if membership.Status == model.MembershipLapsed {
+			return status.Errorf(codes.FailedPrecondition, "membership has already lapsed")
+		}
+
+		now := time.Now().UTC()
+
+		if membership.EndsAt.After(now) {
+			membership.EndsAt = now
+		}
+
+		membership.Status = model.MembershipLapsed
+		membership.UpdatedAt = now
+
+		_, err = tx.NewUpdate().
+			Model(membership).
+			Column("ends_at", "status", "updated_at").
+			WherePK().
+			Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		return syncMember(ctx, tx, membership.UserID)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return getMembershipResponse(membership), nil
+}
+
+// ListUserMemberships lists all membership periods of a user, most recent first
+func (s *Server) ListUserMemberships(ctx context.Context, user *pbUser.UserRequest) (*pbUser.UserMembershipListResponse, error) {
+	if err := s.authorizeUser(ctx, s.db, user.Id); err != nil {
+		return nil, err
+	}
+
+	var memberships []model.Membership
+
+	err := s.db.NewSelect().
+		Model(&memberships).
+		Where("user_id = ?", user.Id).
+		Order("starts_at DESC").
+		Scan(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var results pbUser.UserMembershipListResponse
+
+	for i := range memberships {
+		results.Membership = append(results.Membership, getMembershipResponse(&memberships[i]))
+	}
+
+	return &results, nil
+}
+
+func getMembershipResponse(membership *model.Membership) *pbUser.UserMembershipResponse {
+	return &pbUser.UserMembershipResponse{
+		Id:              membership.ID.String(),
+		Start:           membership.StartsAt.UTC().Format(time.RFC3339),
+		End:             membership.EndsAt.UTC().Format(time.RFC3339),
+		MembershipClass: membership.MembershipClass,
+		Status:          membership.Status,
+		UserId:          membership.UserID.String(),
+	}
+}
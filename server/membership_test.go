@@ -0,0 +1,121 @@
+package server_test
+
+import (
+	"time"
+
+	"github.com/resonatecoop/user-api-template/model"
+
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *UserApiTestSuite) TestMemberships() {
+	ctx := suite.ctx
+
+	added, err := suite.server.AddUser(ctx, &pbUser.UserAddRequest{
+		Username: "member@coop.com",
+		FullName: "Co-op Member",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	isMember := func() bool {
+		u := new(model.User)
+		if err := suite.db.NewSelect().Model(u).Where("id = ?", added.Id).Scan(ctx); err != nil {
+			panic(err)
+		}
+		return u.Member
+	}
+
+	end := time.Now().UTC().Add(24 * time.Hour)
+
+	granted, err := suite.server.GrantMembership(ctx, &pbUser.UserMembershipGrantRequest{
+		UserId:          added.Id,
+		MembershipClass: "listener",
+		End:             end.Format(time.RFC3339),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	assert.Equal(suite.T(), model.MembershipActive, granted.Status)
+	assert.True(suite.T(), isMember())
+
+	// renewing must move the end forward
+	_, err = suite.server.RenewMembership(ctx, &pbUser.UserMembershipRenewRequest{
+		Id:  granted.Id,
+		End: end.Add(-time.Hour).Format(time.RFC3339),
+	})
+	assert.NotNil(suite.T(), err)
+
+	_, err = suite.server.LapseMembership(ctx, &pbUser.UserMembershipRequest{Id: granted.Id})
+	if err != nil {
+		panic(err)
+	}
+
+	assert.False(suite.T(), isMember())
+
+	renewed, err := suite.server.RenewMembership(ctx, &pbUser.UserMembershipRenewRequest{
+		Id:  granted.Id,
+		End: end.Add(365 * 24 * time.Hour).Format(time.RFC3339),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	assert.Equal(suite.T(), model.MembershipActive, renewed.Status)
+	assert.True(suite.T(), isMember())
+
+	// member can't be set directly any more
+	member := false
+	_, err = suite.server.UpdateUserRestricted(ctx, &pbUser.UserUpdateRestrictedRequest{Id: added.Id, Member: &member})
+	assert.NotNil(suite.T(), err)
+
+	// reads derive member from memberships, not the stored column the
+	// periodic sync keeps up to date
+	_, err = suite.db.NewUpdate().
+		Model((*model.User)(nil)).
+		Set("member = false").
+		Where("id = ?", added.Id).
+		Exec(ctx)
+	if err != nil {
+		panic(err)
+	}
+
+	got, err := suite.server.GetUserRestricted(ctx, &pbUser.UserRequest{Id: added.Id})
+	if err != nil {
+		panic(err)
+	}
+	assert.True(suite.T(), got.Member)
+
+	member = true
+	members, err := suite.server.ListUsers(ctx, &pbUser.UserListRequest{Member: &member})
+	if err != nil {
+		panic(err)
+	}
+
+	found := false
+	for _, u := range members.User {
+		if u.Id == added.Id {
+			found = u.Member
+		}
+	}
+	assert.True(suite.T(), found)
+
+	list, err := suite.server.ListUserMemberships(ctx, added)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(suite.T(), 1, len(list.Membership))
+
+	_, err = suite.db.NewDelete().
+		Model((*model.User)(nil)).
+		WhereAllWithDeleted().
+		Where("id = ?", added.Id).
+		ForceDelete().
+		Exec(ctx)
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+
+	uuid "github.com/google/uuid"
+	"github.com/uptrace/bun"
+
+	"github.com/resonatecoop/user-api-template/model"
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+)
+
+// userOwnedGroups are the ids of the groups a user owns, split by group type
+type userOwnedGroups struct {
+	Personas    []string
+	OwnedGroups []string
+}
+
+// loadOwnedGroups loads the groups owned by all of the supplied users in one
+// query joined with their group type, keyed by owner
+func loadOwnedGroups(ctx context.Context, db bun.IDB, userIDs []uuid.UUID) (map[uuid.UUID]*userOwnedGroups, error) {
+	owned := make(map[uuid.UUID]*userOwnedGroups, len(userIDs))
+
+	if len(userIDs) == 0 {
+		return owned, nil
+	}
+
+	var rows []struct {
+		ID       uuid.UUID
+		OwnerID  uuid.UUID
+		TypeName string
+	}
+
+	err := db.NewSelect().
+		Model((*model.UserGroup)(nil)).
+		Column("user_group.id", "user_group.owner_id").
+		ColumnExpr("group_type.name AS type_name").
+		Join("JOIN group_types AS group_type ON group_type.id = user_group.type_id").
+		Where("user_group.owner_id IN (?)", bun.In(userIDs)).
+		OrderExpr("user_group.created_at ASC, user_group.id ASC").
+		Scan(ctx, &rows)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		groups, ok := owned[row.OwnerID]
+
+		if !ok {
+			groups = new(userOwnedGroups)
+			owned[row.OwnerID] = groups
+		}
+
+		if row.TypeName == model.PersonaGroupType {
+			groups.Personas = append(groups.Personas, row.ID.String())
+		} else {
+			groups.OwnedGroups = append(groups.OwnedGroups, row.ID.String())
+		}
+	}
+
+	return owned, nil
+}
+
+// setPrivateOwnedGroups fills in the personas and owned groups of a page of
+// user responses with a single query
+func setPrivateOwnedGroups(ctx context.Context, db bun.IDB, users []*pbUser.UserPrivateResponse) error {
+	userIDs := make([]uuid.UUID, 0, len(users))
+
+	for _, user := range users {
+		if id, err := uuid.Parse(user.Id); err == nil {
+			userIDs = append(userIDs, id)
+		}
+	}
+
+	owned, err := loadOwnedGroups(ctx, db, userIDs)
+
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		id, err := uuid.Parse(user.Id)
+
+		if err != nil {
+			continue
+		}
+
+		if groups, ok := owned[id]; ok {
+			user.Personas = groups.Personas
+			user.OwnedGroups = groups.OwnedGroups
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package server_test
+
+import (
+	"github.com/resonatecoop/user-api-template/model"
+
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *UserApiTestSuite) TestUserOwnedGroups() {
+	ctx := suite.ctx
+
+	added, err := suite.server.AddUser(ctx, &pbUser.UserAddRequest{
+		Username: "owner@groups.com",
+		FullName: "Group Owner",
+		RoleId:   getIntPointer(int32(model.ArtistRole)),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	persona, err := suite.server.AddUserGroup(ctx, &pbUser.UserGroupCreateRequest{
+		Id:          added.Id,
+		DisplayName: "Owner Persona",
+		GroupType:   model.PersonaGroupType,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	band, err := suite.server.AddUserGroup(ctx, &pbUser.UserGroupCreateRequest{
+		Id:          added.Id,
+		DisplayName: "Owner Band",
+		GroupType:   "band",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	public, err := suite.server.GetUser(ctx, &pbUser.UserRequest{Id: added.Id})
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(suite.T(), []string{persona.Id}, public.Personas)
+	assert.Equal(suite.T(), []string{band.Id}, public.OwnedGroups)
+
+	private, err := suite.server.GetUserRestricted(ctx, &pbUser.UserRequest{Id: added.Id})
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(suite.T(), []string{persona.Id}, private.Personas)
+	assert.Equal(suite.T(), []string{band.Id}, private.OwnedGroups)
+
+	_, err = suite.db.NewDelete().
+		Model((*model.UserGroup)(nil)).
+		WhereAllWithDeleted().
+		Where("owner_id = ?", added.Id).
+		ForceDelete().
+		Exec(ctx)
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = suite.db.NewDelete().
+		Model((*model.User)(nil)).
+		WhereAllWithDeleted().
+		Where("id = ?", added.Id).
+		ForceDelete().
+		Exec(ctx)
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	uuid "github.com/google/uuid"
+	zxcvbn "github.com/nbutton23/zxcvbn-go"
+	"github.com/uptrace/bun"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	grpclog "google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/status"
+
+	"github.com/resonatecoop/user-api-template/model"
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+)
+
+// PasswordResetTemplate is the template name handed to the MailSender for
+// password reset messages
+const PasswordResetTemplate = "password-reset"
+
+// RequestPasswordReset emails a password reset token to the user. It succeeds
+// whether or not the username exists, so it can't be used to probe accounts.
+func (s *Server) RequestPasswordReset(ctx context.Context, req *pbUser.PasswordResetRequest) (*pbUser.Empty, error) {
+	u := new(model.User)
+
+	err := s.db.NewSelect().
+		Model(u).
+		Column("id", "username").
+		Where("username = ?", strings.ToLower(req.Username)).
+		Where("anonymized_at IS NULL").
+		Scan(ctx)
+
+	if err != nil {
+		return &pbUser.Empty{}, nil
+	}
+
+	email := model.NewOauthEmail(u.Username, "Reset your password", PasswordResetTemplate)
+
+	if err = s.sendEmailToken(ctx, u.ID, model.EmailTokenResetPassword, email); err != nil {
+		grpclog.Errorf("[user-api] sending password reset to user %s failed: %v", u.ID, err)
+	}
+
+	return &pbUser.Empty{}, nil
+}
+
+// ResetUserPassword sets a new password with an emailed password reset token
+func (s *Server) ResetUserPassword(ctx context.Context, req *pbUser.ResetUserPasswordRequest) (*pbUser.Empty, error) {
+	var userID uuid.UUID
+
+	err := s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		emailToken, claims, err := s.redeemEmailToken(ctx, tx, req.Token, model.EmailTokenResetPassword)
+
+		if err != nil {
+			return err
+		}
+
+		if req.Username != "" && strings.ToLower(req.Username) != claims.Username {
+			return status.Errorf(codes.InvalidArgument, "token was not issued for this username")
+		}
+
+		u := new(model.User)
+
+		err = tx.NewSelect().
+			Model(u).
+			Where("id = ?", emailToken.UserID).
+			Where("username = ?", claims.Username).
+			For("UPDATE").
+			Scan(ctx)
+
+		if err != nil {
+			return status.Errorf(codes.FailedPrecondition, "token does not match the user's current email")
+		}
+
+		userID = u.ID
+
+		return s.setPassword(ctx, tx, u, req.Password)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// setPassword revoked the user's tokens
+	s.cache.InvalidateUser(userID)
+
+	return &pbUser.Empty{}, nil
+}
+
+// ChangePassword replaces a user's password after checking the current one.
+// Users without a password, such as those who registered elsewhere, can set
+// one without supplying current_password.
+func (s *Server) ChangePassword(ctx context.Context, req *pbUser.ChangePasswordRequest) (*pbUser.Empty, error) {
+	id, err := uuid.Parse(req.Id)
+
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "id must be a valid uuid")
+	}
+
+	if err = s.authorizeUser(ctx, s.db, req.Id); err != nil {
+		return nil, err
+	}
+
+	err = s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		u := new(model.User)
+
+		err := tx.NewSelect().
+			Model(u).
+			Where("id = ?", id).
+			For("UPDATE").
+			Scan(ctx)
+
+		if err != nil {
+			return status.Errorf(codes.NotFound, "user not found")
+		}
+
+		if u.Password.Valid {
+			err = bcrypt.CompareHashAndPassword([]byte(u.Password.String), []byte(req.CurrentPassword))
+
+			if err != nil {
+				return status.Errorf(codes.PermissionDenied, "current password is incorrect")
+			}
+		}
+
+		return s.setPassword(ctx, tx, u, req.NewPassword)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.InvalidateUser(id)
+
+	return &pbUser.Empty{}, nil
+}
+
+// setPassword checks the strength of password, stores its bcrypt hash and
+// revokes the user's outstanding access and refresh tokens
+func (s *Server) setPassword(ctx context.Context, tx bun.Tx, u *model.User, password string) error {
+	if password == "" {
+		return status.Errorf(codes.InvalidArgument, "password is required")
+	}
+
+	strength := zxcvbn.PasswordStrength(password, []string{u.Username, u.FullName, u.FirstName, u.LastName})
+
+	if strength.Score < s.cfg.App.MinPasswordStrength {
+		return status.Errorf(codes.InvalidArgument, "password is too weak")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+
+	_, err = tx.NewUpdate().
+		Model((*model.User)(nil)).
+		Set("password = ?", sql.NullString{String: string(hash), Valid: true}).
+		Set("last_password_change = ?", now).
+		Set("updated_at = ?", now).
+		Where("id = ?", u.ID).
+		Exec(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	for _, token := range []interface{}{
+		(*model.AccessToken)(nil),
+		(*model.RefreshToken)(nil),
+	} {
+		_, err = tx.NewDelete().
+			Model(token).
+			WhereAllWithDeleted().
+			Where("user_id = ?", u.ID).
+			ForceDelete().
+			Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package server_test
+
+import (
+	"github.com/resonatecoop/user-api-template/model"
+	"github.com/resonatecoop/user-api-template/server"
+
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *UserApiTestSuite) TestResetAndChangePassword() {
+	ctx := suite.ctx
+
+	mailer := new(recordingMailSender)
+	srv := server.New(suite.db, suite.cfg, server.WithMailSender(mailer))
+
+	added, err := srv.AddUser(ctx, &pbUser.UserAddRequest{
+		Username: "reset@me.com",
+		FullName: "Reset Me",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	// unknown usernames are not revealed
+	_, err = srv.RequestPasswordReset(ctx, &pbUser.PasswordResetRequest{Username: "nobody@nowhere.com"})
+	assert.Nil(suite.T(), err)
+
+	_, err = srv.RequestPasswordReset(ctx, &pbUser.PasswordResetRequest{Username: "reset@me.com"})
+	if err != nil {
+		panic(err)
+	}
+
+	// the confirmation and reset emails have been sent
+	if !assert.Equal(suite.T(), 2, len(mailer.sent)) {
+		return
+	}
+
+	// an email confirmation token can't reset a password
+	_, err = srv.ResetUserPassword(ctx, &pbUser.ResetUserPasswordRequest{
+		Token:    mailer.sent[0]["token"],
+		Password: "correct horse battery staple",
+	})
+	assert.NotNil(suite.T(), err)
+
+	_, err = srv.ResetUserPassword(ctx, &pbUser.ResetUserPasswordRequest{
+		Token:    mailer.sent[1]["token"],
+		Password: "correct horse battery staple",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = srv.ChangePassword(ctx, &pbUser.ChangePasswordRequest{
+		Id:              added.Id,
+		CurrentPassword: "wrong password",
+		NewPassword:     "another long passphrase",
+	})
+	assert.NotNil(suite.T(), err)
+
+	_, err = srv.ChangePassword(ctx, &pbUser.ChangePasswordRequest{
+		Id:              added.Id,
+		CurrentPassword: "correct horse battery staple",
+		NewPassword:     "another long passphrase",
+	})
+	assert.Nil(suite.T(), err)
+
+	changed := new(model.User)
+
+	err = suite.db.NewSelect().Model(changed).Where("id = ?", added.Id).Scan(ctx)
+	if err != nil {
+		panic(err)
+	}
+	assert.True(suite.T(), changed.Password.Valid)
+	assert.False(suite.T(), changed.LastPasswordChange.IsZero())
+
+	_, err = suite.db.NewDelete().
+		Model((*model.User)(nil)).
+		WhereAllWithDeleted().
+		Where("id = ?", added.Id).
+		ForceDelete().
+		Exec(ctx)
+	if err != nil {
+		panic(err)
+	}
+}
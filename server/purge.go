@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	uuid "github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	grpclog "google.golang.org/grpc/grpclog"
+
+	"github.com/resonatecoop/user-api-template/model"
+)
+
+// RunPurge purges users whose deletion grace period has expired, once per
+// configured purge interval, until ctx is cancelled.
+func (s *Server) RunPurge(ctx context.Context) {
+	ticker := time.NewTicker(s.purgeInterval())
+	defer ticker.Stop()
+
+	for {
+		purged, err := s.PurgeExpiredUsers(ctx)
+
+		if err != nil {
+			grpclog.Errorf("[user-api-purge] purge failed: %v", err)
+		} else if purged > 0 {
+			grpclog.Infof("[user-api-purge] purged %d deleted users", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeExpiredUsers purges users whose deletion grace period has expired
+func (s *Server) PurgeExpiredUsers(ctx context.Context) (int, error) {
+	return s.PurgeDeletedUsers(ctx, time.Now().UTC().Add(-s.deletionGracePeriod()))
+}
+
+// PurgeDeletedUsers hard deletes users soft deleted before the cutoff, along
+// with their user groups, tokens and authorization codes, in one transaction.
+// It returns the number of users purged.
+func (s *Server) PurgeDeletedUsers(ctx context.Context, cutoff time.Time) (int, error) {
+	var purged int
+
+	err := s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var userIDs []uuid.UUID
+
+		err := tx.NewSelect().
+			Model((*model.User)(nil)).
+			Column("id").
+			WhereDeleted().
+			Where("deleted_at < ?", cutoff).
+			For("UPDATE SKIP LOCKED").
+			Scan(ctx, &userIDs)
+
+		if err != nil {
+			return err
+		}
+
+		if len(userIDs) == 0 {
+			return nil
+		}
+
+		var groups []model.UserGroup
+
+		err = tx.NewSelect().
+			Model(&groups).
+			Column("id", "links").
+			WhereAllWithDeleted().
+			Where("owner_id IN (?)", bun.In(userIDs)).
+			Scan(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		if len(groups) > 0 {
+			if err := purgeUserGroups(ctx, tx, groups); err != nil {
+				return err
+			}
+		}
+
+		for _, token := range []interface{}{
+			(*model.AccessToken)(nil),
+			(*model.RefreshToken)(nil),
+			(*model.AuthorizationCode)(nil),
+			(*model.EmailToken)(nil),
+		} {
+			_, err = tx.NewDelete().
+				Model(token).
+				WhereAllWithDeleted().
+				Where("user_id IN (?)", bun.In(userIDs)).
+				ForceDelete().
+				Exec(ctx)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		// residence addresses belong to their user alone
+		_, err = tx.NewDelete().
+			Model((*model.StreetAddress)(nil)).
+			Where("id IN (SELECT residence_address_id FROM users WHERE id IN (?))", bun.In(userIDs)).
+			Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewDelete().
+			Model((*model.User)(nil)).
+			WhereAllWithDeleted().
+			Where("id IN (?)", bun.In(userIDs)).
+			ForceDelete().
+			Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		purged = len(userIDs)
+
+		return nil
+	})
+
+	return purged, err
+}
+
+// purgeUserGroups hard deletes the supplied groups, drops them from followers'
+// followed_groups and removes any of their links no other group refers to
+func purgeUserGroups(ctx context.Context, tx bun.Tx, groups []model.UserGroup) error {
+	groupIDs := make([]uuid.UUID, len(groups))
+
+	var linkIDs []uuid.UUID
+
+	for i := range groups {
+		groupIDs[i] = groups[i].ID
+		linkIDs = append(linkIDs, groups[i].Links...)
+	}
+
+	_, err := tx.NewDelete().
+		Model((*model.UserGroup)(nil)).
+		WhereAllWithDeleted().
+		Where("id IN (?)", bun.In(groupIDs)).
+		ForceDelete().
+		Exec(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.NewUpdate().
+		Model((*model.User)(nil)).
+		Set("followed_groups = array(SELECT g FROM unnest(followed_groups) AS g WHERE g <> ALL(?))", pgdialect.Array(groupIDs)).
+		WhereAllWithDeleted().
+		Where("followed_groups && ?", pgdialect.Array(groupIDs)).
+		Exec(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if len(linkIDs) == 0 {
+		return nil
+	}
+
+	_, err = tx.NewDelete().
+		Model((*model.Link)(nil)).
+		Where("link.id IN (?)", bun.In(linkIDs)).
+		Where("NOT EXISTS (SELECT 1 FROM user_groups WHERE link.id = ANY(user_groups.links))").
+		Exec(ctx)
+
+	return err
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/resonatecoop/user-api-template/model"
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+)
+
+// ListRoles lists the roles users can have, most privileged first
+func (s *Server) ListRoles(ctx context.Context, req *pbUser.Empty) (*pbUser.RoleListResponse, error) {
+	var roles []model.Role
+
+	err := s.db.NewSelect().
+		Model(&roles).
+		Order("id ASC").
+		Scan(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := roleUserCounts(ctx, s.db)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var results pbUser.RoleListResponse
+
+	for i := range roles {
+		results.Roles = append(results.Roles, getRoleResponse(&roles[i], counts[roles[i].ID]))
+	}
+
+	return &results, nil
+}
+
+// GetRole returns a role with the number of users having it
+func (s *Server) GetRole(ctx context.Context, req *pbUser.RoleRequest) (*pbUser.RoleResponse, error) {
+	role := new(model.Role)
+
+	err := s.db.NewSelect().
+		Model(role).
+		Where("id = ?", req.Id).
+		Scan(ctx)
+
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "role not found")
+	}
+
+	counts, err := roleUserCounts(ctx, s.db)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return getRoleResponse(role, counts[role.ID]), nil
+}
+
+// SetDefaultRole makes a role the one AddUser gives users signing up without
+// one, in place of the current default
+func (s *Server) SetDefaultRole(ctx context.Context, req *pbUser.RoleRequest) (*pbUser.RoleResponse, error) {
+	// AddUser only lets signups pick roles from LabelRole down, the default
+	// can't be more privileged
+	if req.Id < int32(model.LabelRole) {
+		return nil, status.Errorf(codes.InvalidArgument, "admin roles can't be the default role")
+	}
+
+	role := new(model.Role)
+
+	err := s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewSelect().
+			Model(role).
+			Where("id = ?", req.Id).
+			For("UPDATE").
+			Scan(ctx)
+
+		if err != nil {
+			return status.Errorf(codes.NotFound, "role not found")
+		}
+
+		_, err = tx.NewUpdate().
+			Model((*model.Role)(nil)).
+			Set("is_default = FALSE").
+			Where("is_default = TRUE").
+			Where("id != ?", role.ID).
+			Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		role.IsDefault = true
+
+		_, err = tx.NewUpdate().
+			Model(role).
+			Column("is_default").
+			Where("id = ?", role.ID).
+			Exec(ctx)
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := roleUserCounts(ctx, s.db)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return getRoleResponse(role, counts[role.ID]), nil
+}
+
+// ListRoleUsers lists a page of the users having a role, as ListUsers does
+func (s *Server) ListRoleUsers(ctx context.Context, req *pbUser.RoleUsersRequest) (*pbUser.UserListResponse, error) {
+	exists, err := s.db.NewSelect().
+		Model((*model.Role)(nil)).
+		Where("id = ?", req.Id).
+		Exists(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, status.Errorf(codes.NotFound, "role not found")
+	}
+
+	return s.ListUsers(ctx, &pbUser.UserListRequest{
+		PageSize:  req.PageSize,
+		PageToken: req.PageToken,
+		OrderBy:   req.OrderBy,
+		RoleId:    &req.Id,
+	})
+}
+
+// roleUserCounts counts the users, not deleted, having each role. Tenant
+// admins only count the users of their tenant.
+func roleUserCounts(ctx context.Context, db bun.IDB) (map[int32]int64, error) {
+	var rows []struct {
+		RoleID int32
+		Users  int64
+	}
+
+	q := db.NewSelect().
+		Model((*model.User)(nil)).
+		ColumnExpr("role_id").
+		ColumnExpr("count(*) AS users").
+		Group("role_id")
+
+	if filter := tenantFilter(ctx); filter != "" {
+		q.Where(filter)
+	}
+
+	if err := q.Scan(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[int32]int64, len(rows))
+
+	for _, row := range rows {
+		counts[row.RoleID] = row.Users
+	}
+
+	return counts, nil
+}
+
+func getRoleResponse(role *model.Role, userCount int64) *pbUser.RoleResponse {
+	return &pbUser.RoleResponse{
+		Id:          role.ID,
+		Name:        role.Name,
+		Description: role.Description,
+		IsDefault:   role.IsDefault,
+		UserCount:   userCount,
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	uuid "github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/resonatecoop/user-api-template/authorization"
+	"github.com/resonatecoop/user-api-template/model"
+)
+
+// Rules of the role assignment policy, named in the errors of requests
+// breaking them
+const (
+	// ruleGrantLowerRoles lets requestors grant only roles lower than their
+	// own, except super admins who grant any role
+	ruleGrantLowerRoles = "grant-lower-roles-only"
+
+	// ruleChangeLowerUsers lets requestors change only the role of users whose
+	// role is lower than their own, except super admins
+	ruleChangeLowerUsers = "change-lower-users-only"
+
+	// ruleNoSelfDemotion stops admins from lowering their own role below
+	// admin, which they couldn't undo
+	ruleNoSelfDemotion = "no-self-demotion"
+)
+
+func roleAssignmentDenied(rule string, reason string) error {
+	return status.Errorf(codes.PermissionDenied, "role assignment denied by rule %s: %s", rule, reason)
+}
+
+// checkRoleAssignment applies the role assignment policy to the requestor on
+// ctx giving role to user id, who currently has role current, or 0 for users
+// being created. Internal calls without an AuthUser aren't restricted.
+func (s *Server) checkRoleAssignment(ctx context.Context, id uuid.UUID, current int32, role int32) error {
+	authUser := authorization.AuthUserFromContext(ctx)
+
+	if authUser == nil || current == role {
+		return nil
+	}
+
+	self := authUser.ID == id
+
+	if self && authUser.Role <= model.AdminRole && model.AccessRole(role) > model.AdminRole {
+		return roleAssignmentDenied(ruleNoSelfDemotion, "admins can't lower their own role below admin")
+	}
+
+	if s.rbac.EnforceRole(ctx, model.SuperAdminRole) {
+		return nil
+	}
+
+	if !s.rbac.IsLowerRole(ctx, model.AccessRole(role)) {
+		return roleAssignmentDenied(ruleGrantLowerRoles, "requestors can only grant roles lower than their own")
+	}
+
+	if !self && current != 0 && !s.rbac.IsLowerRole(ctx, model.AccessRole(current)) {
+		return roleAssignmentDenied(ruleChangeLowerUsers, "requestors can only change the role of users with a lower role than their own")
+	}
+
+	return nil
+}
+
+// authorizeRoleChange loads the current role of user id and applies the role
+// assignment policy to changing it to role
+func (s *Server) authorizeRoleChange(ctx context.Context, db bun.IDB, id string, role int32) error {
+	userID, err := uuid.Parse(id)
+
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "id must be a valid uuid")
+	}
+
+	var current int32
+
+	err = db.NewSelect().
+		Model((*model.User)(nil)).
+		Column("role_id").
+		Where("id = ?", userID).
+		Scan(ctx, &current)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return status.Errorf(codes.NotFound, "user not found")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return s.checkRoleAssignment(ctx, userID, current, role)
+}
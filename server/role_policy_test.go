@@ -0,0 +1,197 @@
+package server_test
+
+import (
+	"context"
+	"time"
+
+	uuid "github.com/google/uuid"
+	"github.com/resonatecoop/user-api-template/authorization"
+	"github.com/resonatecoop/user-api-template/model"
+	"github.com/resonatecoop/user-api-template/pkg/access"
+
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func (suite *UserApiTestSuite) TestRoleAssignmentPolicy() {
+	ctx := suite.ctx
+
+	ids := make(map[model.AccessRole]string)
+
+	for role, username := range map[model.AccessRole]string{
+		model.AdminRole:       "policy.admin@user.com",
+		model.TenantAdminRole: "policy.tenantadmin@user.com",
+		model.UserRole:        "policy.user@user.com",
+	} {
+		added, err := suite.server.AddUser(ctx, &pbUser.UserAddRequest{
+			Username: username,
+			FullName: "Policy User",
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		// internal calls aren't held to the policy
+		_, err = suite.server.UpdateUserRestricted(ctx, &pbUser.UserUpdateRestrictedRequest{
+			Id:     added.Id,
+			RoleId: getIntPointer(int32(role)),
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		ids[role] = added.Id
+	}
+
+	// users can't promote themselves through UpdateUser
+	userCtx := authorization.ContextWithAuthUser(ctx, &model.AuthUser{
+		ID:   uuid.MustParse(ids[model.UserRole]),
+		Role: model.UserRole,
+	})
+
+	_, err := suite.server.UpdateUser(userCtx, &pbUser.UserUpdateRequest{
+		Id:     ids[model.UserRole],
+		RoleId: getIntPointer(int32(model.ArtistRole)),
+	})
+	assert.Contains(suite.T(), status.Convert(err).Message(), "grant-lower-roles-only")
+
+	grant := func(role model.AccessRole) *pbUser.UserUpdateRestrictedRequest {
+		return &pbUser.UserUpdateRestrictedRequest{Id: ids[model.UserRole], RoleId: getIntPointer(int32(role))}
+	}
+
+	tenantAdminCtx := authorization.ContextWithAuthUser(ctx, &model.AuthUser{
+		ID:   uuid.MustParse(ids[model.TenantAdminRole]),
+		Role: model.TenantAdminRole,
+	})
+
+	_, err = suite.server.UpdateUserRestricted(tenantAdminCtx, grant(model.SuperAdminRole))
+	assert.Equal(suite.T(), codes.PermissionDenied, status.Code(err))
+	assert.Contains(suite.T(), status.Convert(err).Message(), "grant-lower-roles-only")
+
+	_, err = suite.server.UpdateUserRestricted(tenantAdminCtx, grant(model.TenantAdminRole))
+	assert.Equal(suite.T(), codes.PermissionDenied, status.Code(err))
+
+	_, err = suite.server.UpdateUserRestricted(tenantAdminCtx, grant(model.LabelRole))
+	assert.Nil(suite.T(), err)
+
+	// nor can they demote an admin
+	_, err = suite.server.UpdateUserRestricted(tenantAdminCtx, &pbUser.UserUpdateRestrictedRequest{
+		Id:     ids[model.AdminRole],
+		RoleId: getIntPointer(int32(model.UserRole)),
+	})
+	assert.Contains(suite.T(), status.Convert(err).Message(), "change-lower-users-only")
+
+	adminCtx := authorization.ContextWithAuthUser(ctx, &model.AuthUser{
+		ID:   uuid.MustParse(ids[model.AdminRole]),
+		Role: model.AdminRole,
+	})
+
+	_, err = suite.server.UpdateUserRestricted(adminCtx, &pbUser.UserUpdateRestrictedRequest{
+		Id:     ids[model.AdminRole],
+		RoleId: getIntPointer(int32(model.UserRole)),
+	})
+	assert.Contains(suite.T(), status.Convert(err).Message(), "no-self-demotion")
+
+	superAdminCtx := authorization.ContextWithAuthUser(ctx, &model.AuthUser{
+		ID:   uuid.Must(uuid.NewRandom()),
+		Role: model.SuperAdminRole,
+	})
+
+	_, err = suite.server.UpdateUserRestricted(superAdminCtx, grant(model.AdminRole))
+	assert.Nil(suite.T(), err)
+
+	u := new(model.User)
+
+	err = suite.db.NewSelect().Model(u).Where("id = ?", ids[model.UserRole]).Scan(ctx)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(suite.T(), int32(model.AdminRole), u.RoleID)
+}
+
+func (suite *UserApiTestSuite) TestAddUserRolePolicy() {
+	ctx := suite.ctx
+
+	tenantAdmin := uuid.MustParse("243b4178-6f98-4bf1-bbb1-46b57a901816")
+	artist := uuid.MustParse("5253747c-2b8c-40e2-8a70-bab91348a9bd")
+
+	interceptor := authorization.NewAuthInterceptor(
+		suite.db,
+		authorization.NewRefreshExtender(suite.db, time.Hour, time.Hour),
+		access.New("/user.ResonateUser/AddUser", "", "", ""),
+		nil,
+		nil,
+	).Unary()
+
+	for token, userID := range map[string]uuid.UUID{
+		"policy_artist":       artist,
+		"policy_tenant_admin": tenantAdmin,
+	} {
+		_, err := suite.db.NewInsert().
+			Model(&model.AccessToken{
+				ClientID:  uuid.MustParse("3392e754-ba3e-424f-a687-add9a8ab39c9"),
+				UserID:    userID,
+				Token:     token,
+				ExpiresAt: time.Now().UTC().Add(time.Hour),
+				Scope:     "users:write",
+			}).
+			Exec(ctx)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// addUser calls AddUser through the interceptor, sending token when set
+	addUser := func(token string, username string, role model.AccessRole) (*pbUser.UserRequest, error) {
+		callCtx := ctx
+
+		if token != "" {
+			callCtx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+token))
+		}
+
+		req := &pbUser.UserAddRequest{
+			Username: username,
+			FullName: "Policy Signup",
+			RoleId:   getIntPointer(int32(role)),
+		}
+
+		resp, err := interceptor(callCtx, req, &grpc.UnaryServerInfo{FullMethod: "/user.ResonateUser/AddUser"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return suite.server.AddUser(ctx, req.(*pbUser.UserAddRequest))
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return resp.(*pbUser.UserRequest), nil
+	}
+
+	// the token of an authenticated requestor holds them to the policy
+	_, err := addUser("policy_artist", "policy.label@user.com", model.LabelRole)
+	assert.Equal(suite.T(), codes.PermissionDenied, status.Code(err))
+	assert.Contains(suite.T(), status.Convert(err).Message(), "grant-lower-roles-only")
+
+	_, err = addUser("policy_tenant_admin", "policy.label@user.com", model.LabelRole)
+	assert.Nil(suite.T(), err)
+
+	// an invalid token isn't ignored
+	_, err = addUser("unknown_token", "policy.unknown@user.com", model.UserRole)
+	assert.Equal(suite.T(), codes.Unauthenticated, status.Code(err))
+
+	// anonymous signups can't pick an admin role
+	added, err := addUser("", "policy.signup@user.com", model.TenantAdminRole)
+	if err != nil {
+		panic(err)
+	}
+
+	u := new(model.User)
+
+	err = suite.db.NewSelect().Model(u).Where("id = ?", added.Id).Scan(ctx)
+	if err != nil {
+		panic(err)
+	}
+	assert.NotEqual(suite.T(), int32(model.TenantAdminRole), u.RoleID)
+}
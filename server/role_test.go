@@ -0,0 +1,60 @@
+package server_test
+
+import (
+	"github.com/resonatecoop/user-api-template/model"
+
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (suite *UserApiTestSuite) TestRoles() {
+	ctx := suite.ctx
+
+	roles, err := suite.server.ListRoles(ctx, &pbUser.Empty{})
+	if err != nil {
+		panic(err)
+	}
+
+	if assert.Len(suite.T(), roles.Roles, 6) {
+		assert.Equal(suite.T(), int32(model.SuperAdminRole), roles.Roles[0].Id)
+		assert.True(suite.T(), roles.Roles[5].IsDefault)
+	}
+
+	_, err = suite.server.GetRole(ctx, &pbUser.RoleRequest{Id: 99})
+	assert.Equal(suite.T(), codes.NotFound, status.Code(err))
+
+	// signups can never default to an admin role
+	_, err = suite.server.SetDefaultRole(ctx, &pbUser.RoleRequest{Id: int32(model.AdminRole)})
+	assert.Equal(suite.T(), codes.InvalidArgument, status.Code(err))
+
+	role, err := suite.server.SetDefaultRole(ctx, &pbUser.RoleRequest{Id: int32(model.ArtistRole)})
+	if err != nil {
+		panic(err)
+	}
+	assert.True(suite.T(), role.IsDefault)
+
+	previous, err := suite.server.GetRole(ctx, &pbUser.RoleRequest{Id: int32(model.UserRole)})
+	if err != nil {
+		panic(err)
+	}
+	assert.False(suite.T(), previous.IsDefault)
+
+	_, err = suite.server.SetDefaultRole(ctx, &pbUser.RoleRequest{Id: int32(model.UserRole)})
+	if err != nil {
+		panic(err)
+	}
+
+	users, err := suite.server.ListRoleUsers(ctx, &pbUser.RoleUsersRequest{Id: int32(model.SuperAdminRole)})
+	if err != nil {
+		panic(err)
+	}
+
+	for _, user := range users.User {
+		assert.Equal(suite.T(), int32(model.SuperAdminRole), user.RoleId)
+	}
+
+	_, err = suite.server.ListRoleUsers(ctx, &pbUser.RoleUsersRequest{Id: 99})
+	assert.Equal(suite.T(), codes.NotFound, status.Code(err))
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	uuid "github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/resonatecoop/user-api-template/authorization"
+	"github.com/resonatecoop/user-api-template/internal/pkg/query"
+	"github.com/resonatecoop/user-api-template/model"
+)
+
+var (
+	errOtherTenant = status.Errorf(codes.PermissionDenied, "requestor is not authorized to access another tenant")
+	errOtherUser   = status.Errorf(codes.PermissionDenied, "requestor is not authorized to take action on another user record")
+)
+
+// tenantFilter returns the condition on users.tenant_id that queries listing
+// users run for the requestor on ctx must add, or "" when there is none
+func tenantFilter(ctx context.Context) string {
+	authUser := authorization.AuthUserFromContext(ctx)
+
+	if authUser == nil {
+		return ""
+	}
+
+	return query.ForTenant(authUser, 0)
+}
+
+// authorizeTenant returns PermissionDenied when the requestor on ctx may not
+// act on tenant id
+func (s *Server) authorizeTenant(ctx context.Context, id int32) error {
+	if !s.rbac.EnforceTenant(ctx, id) {
+		return errOtherTenant
+	}
+
+	return nil
+}
+
+// authorizeUser returns PermissionDenied when the requestor on ctx may not
+// act on user id, deleted or not, because it isn't them or is in another
+// tenant. Unknown users pass, for the handler to report.
+func (s *Server) authorizeUser(ctx context.Context, db bun.IDB, id string) error {
+	userID, err := uuid.Parse(id)
+
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "id must be a valid uuid")
+	}
+
+	if !s.rbac.EnforceUser(ctx, userID) {
+		return errOtherUser
+	}
+
+	// admins act on every tenant, no need to look it up
+	if s.rbac.EnforceRole(ctx, model.AdminRole) {
+		return nil
+	}
+
+	var tenantID int32
+
+	err = db.NewSelect().
+		Model((*model.User)(nil)).
+		Column("tenant_id").
+		WhereAllWithDeleted().
+		Where("id = ?", userID).
+		Scan(ctx, &tenantID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return s.authorizeTenant(ctx, tenantID)
+}
+
+// authorizeUserGroup returns PermissionDenied when the requestor on ctx may
+// not act on user group id, because they don't own it or its owner is in
+// another tenant. Unknown groups pass, for the handler to report.
+func (s *Server) authorizeUserGroup(ctx context.Context, db bun.IDB, id string) error {
+	if s.rbac.EnforceRole(ctx, model.AdminRole) {
+		return nil
+	}
+
+	var owner struct {
+		OwnerID  uuid.UUID
+		TenantID int32
+	}
+
+	err := db.NewSelect().
+		TableExpr("user_groups AS g").
+		ColumnExpr("g.owner_id, u.tenant_id").
+		Join("JOIN users AS u ON u.id = g.owner_id").
+		Where("g.id = ?", id).
+		Scan(ctx, &owner)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !s.rbac.EnforceUser(ctx, owner.OwnerID) {
+		return status.Errorf(codes.PermissionDenied, "requestor doesn't own the user group")
+	}
+
+	return s.authorizeTenant(ctx, owner.TenantID)
+}
@@ -0,0 +1,158 @@
+package server_test
+
+import (
+	uuid "github.com/google/uuid"
+	"github.com/resonatecoop/user-api-template/authorization"
+	"github.com/resonatecoop/user-api-template/model"
+
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (suite *UserApiTestSuite) TestTenantAdminScope() {
+	ctx := suite.ctx
+
+	var tenantIDs []int32
+	var userIDs []string
+
+	for _, fixture := range []struct{ tenant, username string }{
+		{"Scope Tenant One", "scope.one@user.com"},
+		{"Scope Tenant Two", "scope.two@user.com"},
+	} {
+		tenant, err := suite.server.CreateTenant(ctx, &pbUser.TenantCreateRequest{Name: fixture.tenant})
+		if err != nil {
+			panic(err)
+		}
+
+		defer suite.db.NewDelete().
+			Model((*model.Tenant)(nil)).
+			Where("id = ?", tenant.Id).
+			Exec(ctx)
+
+		added, err := suite.server.AddUser(ctx, &pbUser.UserAddRequest{
+			Username: fixture.username,
+			FullName: "Scope User",
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		_, err = suite.server.UpdateUserRestricted(ctx, &pbUser.UserUpdateRestrictedRequest{Id: added.Id, TenantId: &tenant.Id})
+		if err != nil {
+			panic(err)
+		}
+
+		tenantIDs = append(tenantIDs, tenant.Id)
+		userIDs = append(userIDs, added.Id)
+	}
+
+	own, other := userIDs[0], userIDs[1]
+
+	adminCtx := authorization.ContextWithAuthUser(ctx, &model.AuthUser{
+		Username: "tenant.admin@user.com",
+		TenantID: tenantIDs[0],
+		Role:     model.TenantAdminRole,
+	})
+
+	// users of their own tenant are reachable
+	_, err := suite.server.GetUserRestricted(adminCtx, &pbUser.UserRequest{Id: own})
+	assert.Nil(suite.T(), err)
+
+	_, err = suite.server.GetUserRestricted(adminCtx, &pbUser.UserRequest{Id: other})
+	assert.Equal(suite.T(), codes.PermissionDenied, status.Code(err))
+
+	_, err = suite.server.GetUser(adminCtx, &pbUser.UserRequest{Id: other})
+	assert.Equal(suite.T(), codes.PermissionDenied, status.Code(err))
+
+	fullName := "Changed Name"
+
+	_, err = suite.server.UpdateUserRestricted(adminCtx, &pbUser.UserUpdateRestrictedRequest{Id: other, FullName: &fullName})
+	assert.Equal(suite.T(), codes.PermissionDenied, status.Code(err))
+
+	_, err = suite.server.UpdateUser(adminCtx, &pbUser.UserUpdateRequest{Id: other, FullName: &fullName})
+	assert.Equal(suite.T(), codes.PermissionDenied, status.Code(err))
+
+	// nor can they move their users to another tenant
+	_, err = suite.server.UpdateUserRestricted(adminCtx, &pbUser.UserUpdateRestrictedRequest{Id: own, TenantId: &tenantIDs[1]})
+	assert.Equal(suite.T(), codes.PermissionDenied, status.Code(err))
+
+	_, err = suite.server.DeleteUser(adminCtx, &pbUser.UserRequest{Id: other})
+	assert.Equal(suite.T(), codes.PermissionDenied, status.Code(err))
+
+	_, err = suite.server.ListUsersUserGroups(adminCtx, &pbUser.UserRequest{Id: other})
+	assert.Equal(suite.T(), codes.PermissionDenied, status.Code(err))
+
+	u := new(model.User)
+
+	err = suite.db.NewSelect().Model(u).Where("id = ?", other).Scan(ctx)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(suite.T(), "Scope User", u.FullName)
+
+	// lists only hold their own tenant, which is all they may filter on
+	list, err := suite.server.ListUsers(adminCtx, &pbUser.UserListRequest{PageSize: 500})
+	if err != nil {
+		panic(err)
+	}
+
+	for _, user := range list.User {
+		assert.Equal(suite.T(), tenantIDs[0], user.TenantId)
+	}
+
+	_, err = suite.server.ListUsers(adminCtx, &pbUser.UserListRequest{TenantId: &tenantIDs[1]})
+	assert.Equal(suite.T(), codes.PermissionDenied, status.Code(err))
+
+	search, err := suite.server.SearchUsers(adminCtx, &pbUser.UserSearchRequest{Query: "scope user"})
+	if err != nil {
+		panic(err)
+	}
+
+	for _, result := range search.Results {
+		assert.NotEqual(suite.T(), other, result.User.Id)
+	}
+
+	// admins act across tenants
+	superCtx := authorization.ContextWithAuthUser(ctx, &model.AuthUser{
+		TenantID: tenantIDs[0],
+		Role:     model.AdminRole,
+	})
+
+	_, err = suite.server.GetUserRestricted(superCtx, &pbUser.UserRequest{Id: other})
+	assert.Nil(suite.T(), err)
+}
+
+func (suite *UserApiTestSuite) TestUserOwnership() {
+	ctx := suite.ctx
+
+	own := "243b4178-6f98-4bf1-bbb1-46b57a901816"
+	other := "5253747c-2b8c-40e2-8a70-bab91348a9bd"
+
+	userCtx := authorization.ContextWithAuthUser(ctx, &model.AuthUser{
+		ID:   uuid.MustParse(own),
+		Role: model.UserRole,
+	})
+
+	_, err := suite.server.GetUser(userCtx, &pbUser.UserRequest{Id: own})
+	assert.Nil(suite.T(), err)
+
+	_, err = suite.server.GetUser(userCtx, &pbUser.UserRequest{Id: other})
+	assert.Equal(suite.T(), codes.PermissionDenied, status.Code(err))
+
+	_, err = suite.server.ExportUserData(userCtx, &pbUser.UserExportRequest{Id: other})
+	assert.Equal(suite.T(), codes.PermissionDenied, status.Code(err))
+
+	_, err = suite.server.GetUserCredits(userCtx, &pbUser.UserCreditRequest{Id: other})
+	assert.Equal(suite.T(), codes.PermissionDenied, status.Code(err))
+
+	// signing up as a label doesn't give access to other users
+	labelCtx := authorization.ContextWithAuthUser(ctx, &model.AuthUser{
+		ID:   uuid.MustParse(own),
+		Role: model.LabelRole,
+	})
+
+	_, err = suite.server.ChangePassword(labelCtx, &pbUser.ChangePasswordRequest{Id: other, NewPassword: "new password"})
+	assert.Equal(suite.T(), codes.PermissionDenied, status.Code(err))
+}
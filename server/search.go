@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/uptrace/bun"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/resonatecoop/user-api-template/internal/pkg/pagination"
+	"github.com/resonatecoop/user-api-template/model"
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+)
+
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 100
+
+	searchHeadlineOptions = "StartSel=<b>, StopSel=</b>, HighlightAll=true"
+)
+
+var searchTermSeparator = regexp.MustCompile(`[^\pL\pN]+`)
+
+// userSearchRow is a user row together with its search rank and highlighted fields
+type userSearchRow struct {
+	model.User
+	Rank              float64
+	HeadlineUsername  string
+	HeadlineFullName  string
+	HeadlineFirstName string
+	HeadlineLastName  string
+}
+
+// SearchUsers finds users by partial username, full, first or last name.
+// Results are ordered by relevance and paginated with a keyset over (rank, id).
+func (s *Server) SearchUsers(ctx context.Context, req *pbUser.UserSearchRequest) (*pbUser.UserSearchResponse, error) {
+	query := strings.TrimSpace(req.Query)
+
+	if query == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "argument query is required")
+	}
+
+	tsQuery := prefixTsQuery(query)
+
+	pageSize := pagination.PageSize(req.PageSize, defaultSearchPageSize, maxSearchPageSize)
+
+	matches := s.db.NewSelect().
+		Model((*model.User)(nil)).
+		Column("user.*").
+		ColumnExpr("(ts_rank(to_tsvector('simple', "+model.UserSearchDocument+"), to_tsquery('simple', ?)) + word_similarity(?, "+model.UserSearchDocument+"))::float8 AS rank", tsQuery, query).
+		ColumnExpr("ts_headline('simple', coalesce(username, ''), to_tsquery('simple', ?), ?) AS headline_username", tsQuery, searchHeadlineOptions).
+		ColumnExpr("ts_headline('simple', coalesce(full_name, ''), to_tsquery('simple', ?), ?) AS headline_full_name", tsQuery, searchHeadlineOptions).
+		ColumnExpr("ts_headline('simple', coalesce(first_name, ''), to_tsquery('simple', ?), ?) AS headline_first_name", tsQuery, searchHeadlineOptions).
+		ColumnExpr("ts_headline('simple', coalesce(last_name, ''), to_tsquery('simple', ?), ?) AS headline_last_name", tsQuery, searchHeadlineOptions).
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.
+				Where("to_tsvector('simple', "+model.UserSearchDocument+") @@ to_tsquery('simple', ?)", tsQuery).
+				WhereOr("? <% ("+model.UserSearchDocument+")", query)
+		})
+
+	if filter := tenantFilter(ctx); filter != "" {
+		matches.Where(filter)
+	}
+
+	q := s.db.NewSelect().
+		TableExpr("(?) AS search", matches)
+
+	if req.PageToken != "" {
+		cursor, err := pagination.Decode(req.PageToken)
+
+		if err != nil || cursor.OrderBy != query {
+			return nil, status.Errorf(codes.InvalidArgument, "page_token is not valid for this query")
+		}
+
+		rank, err := strconv.ParseFloat(cursor.Key, 64)
+
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "page_token is not valid for this query")
+		}
+
+		q.Where("(search.rank, search.id) < (?, ?)", rank, cursor.ID)
+	}
+
+	var rows []userSearchRow
+
+	err := q.
+		OrderExpr("search.rank DESC, search.id DESC").
+		Limit(pageSize+1).
+		Scan(ctx, &rows)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var results pbUser.UserSearchResponse
+
+	if len(rows) > pageSize {
+		rows = rows[:pageSize]
+
+		last := rows[pageSize-1]
+
+		results.NextPageToken = pagination.Encode(&pagination.Cursor{
+			OrderBy: query,
+			Key:     strconv.FormatFloat(last.Rank, 'g', -1, 64),
+			ID:      last.ID,
+		})
+	}
+
+	for i := range rows {
+		row := &rows[i]
+
+		highlights := make(map[string]string)
+
+		for field, headline := range map[string]string{
+			"username":   row.HeadlineUsername,
+			"full_name":  row.HeadlineFullName,
+			"first_name": row.HeadlineFirstName,
+			"last_name":  row.HeadlineLastName,
+		} {
+			if strings.Contains(headline, "<b>") {
+				highlights[field] = headline
+			}
+		}
+
+		results.Results = append(results.Results, &pbUser.UserSearchResult{
+			User:       getUserPrivateResponse(&row.User),
+			Rank:       row.Rank,
+			Highlights: highlights,
+		})
+	}
+
+	users := make([]*pbUser.UserPrivateResponse, len(results.Results))
+
+	for i, result := range results.Results {
+		users[i] = result.User
+	}
+
+	if err = setPrivateOwnedGroups(ctx, s.db, users); err != nil {
+		return nil, err
+	}
+
+	if err = setPrivateMembers(ctx, s.db, users); err != nil {
+		return nil, err
+	}
+
+	return &results, nil
+}
+
+// prefixTsQuery turns free text into a tsquery matching every term as a prefix,
+// e.g. "mil dav" becomes "mil:* & dav:*"
+func prefixTsQuery(query string) string {
+	var terms []string
+
+	for _, term := range searchTermSeparator.Split(strings.ToLower(query), -1) {
+		if term != "" {
+			terms = append(terms, term+":*")
+		}
+	}
+
+	return strings.Join(terms, " & ")
+}
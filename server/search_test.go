@@ -0,0 +1,58 @@
+package server_test
+
+import (
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *UserApiTestSuite) TestSearchUsers() {
+	ctx := suite.ctx
+
+	// partial first name matches as a prefix
+	response, err := suite.server.SearchUsers(ctx, &pbUser.UserSearchRequest{Query: "mil"})
+	if err != nil {
+		panic(err)
+	}
+
+	if assert.NotEmpty(suite.T(), response.Results) {
+		best := response.Results[0]
+
+		assert.Equal(suite.T(), "5253747c-2b8c-40e2-8a70-bab91348a9bd", best.User.Id)
+		assert.Equal(suite.T(), "<b>Miles</b>", best.Highlights["first_name"])
+	}
+
+	// an empty query is rejected
+	_, err = suite.server.SearchUsers(ctx, &pbUser.UserSearchRequest{Query: " "})
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *UserApiTestSuite) TestSearchUsersPagination() {
+	ctx := suite.ctx
+
+	request := &pbUser.UserSearchRequest{Query: "test", PageSize: 1}
+
+	seen := map[string]bool{}
+
+	for {
+		response, err := suite.server.SearchUsers(ctx, request)
+		if err != nil {
+			panic(err)
+		}
+
+		assert.LessOrEqual(suite.T(), len(response.Results), 1)
+
+		for _, result := range response.Results {
+			assert.False(suite.T(), seen[result.User.Id])
+			seen[result.User.Id] = true
+		}
+
+		if response.NextPageToken == "" {
+			break
+		}
+
+		request.PageToken = response.NextPageToken
+	}
+
+	// test@superuser.com, test@user.com and test@user2.com
+	assert.Equal(suite.T(), 3, len(seen))
+}
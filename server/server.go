@@ -1,15 +1,87 @@
 package server
 
 import (
+	"time"
+
+	uuid "github.com/google/uuid"
 	"github.com/uptrace/bun"
+
+	"github.com/resonatecoop/user-api-template/authorization"
+	"github.com/resonatecoop/user-api-template/model"
+	"github.com/resonatecoop/user-api-template/pkg/config"
+	"github.com/resonatecoop/user-api-template/pkg/rbac"
+)
+
+const (
+	defaultDeletionGracePeriod = 30 * 24 * time.Hour
+	defaultPurgeInterval       = time.Hour
 )
 
 // Server implements the UserService
 type Server struct {
-	db *bun.DB
+	db     *bun.DB
+	cfg    *config.Configuration
+	mailer MailSender
+	rbac   model.RBACService
+	cache  *authorization.Cache
+}
+
+// Option configures optional Server dependencies
+type Option func(*Server)
+
+// WithMailSender sets the MailSender used to deliver emailed tokens
+func WithMailSender(mailer MailSender) Option {
+	return func(s *Server) {
+		s.mailer = mailer
+	}
+}
+
+// WithRBAC sets the RBACService handlers check requestors against
+func WithRBAC(rbac model.RBACService) Option {
+	return func(s *Server) {
+		s.rbac = rbac
+	}
+}
+
+// WithAuthCache sets the auth interceptor Cache handlers invalidate when they
+// change roles, tenants or tokens
+func WithAuthCache(cache *authorization.Cache) Option {
+	return func(s *Server) {
+		s.cache = cache
+	}
 }
 
 // New creates an instance of our server
-func New(db *bun.DB) *Server {
-	return &Server{db: db}
+func New(db *bun.DB, cfg *config.Configuration, opts ...Option) *Server {
+	s := &Server{db: db, cfg: cfg, mailer: logMailSender{}, rbac: rbac.New()}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// invalidateAuthUser drops user id from the auth interceptor cache, once
+// their role, tenant or tokens changed or they're deleted
+func (s *Server) invalidateAuthUser(id string) {
+	if userID, err := uuid.Parse(id); err == nil {
+		s.cache.InvalidateUser(userID)
+	}
+}
+
+// deletionGracePeriod is how long a deleted user can be restored before being purged
+func (s *Server) deletionGracePeriod() time.Duration {
+	if s.cfg.Users.DeletionGracePeriod > 0 {
+		return time.Duration(s.cfg.Users.DeletionGracePeriod) * time.Second
+	}
+	return defaultDeletionGracePeriod
+}
+
+// purgeInterval is how often RunPurge looks for expired deleted users
+func (s *Server) purgeInterval() time.Duration {
+	if s.cfg.Users.PurgeInterval > 0 {
+		return time.Duration(s.cfg.Users.PurgeInterval) * time.Second
+	}
+	return defaultPurgeInterval
 }
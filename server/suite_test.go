@@ -81,7 +81,7 @@ func (suite *UserApiTestSuite) SetupSuite() {
 	suite.ctx = context.Background()
 	suite.db = db
 
-	suite.server = server.New(db)
+	suite.server = server.New(db, cfg)
 
 	// if err != nil {
 	// 	panic(err)
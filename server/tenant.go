@@ -0,0 +1,231 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/resonatecoop/user-api-template/model"
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+)
+
+// CreateTenant adds an active tenant
+func (s *Server) CreateTenant(ctx context.Context, req *pbUser.TenantCreateRequest) (*pbUser.TenantResponse, error) {
+	name := strings.TrimSpace(req.Name)
+
+	if name == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "argument name is required")
+	}
+
+	tenant := &model.Tenant{
+		Name:   name,
+		Active: true,
+	}
+
+	_, err := s.db.NewInsert().
+		Model(tenant).
+		Returning("*").
+		Exec(ctx)
+
+	if isUniqueViolation(err) {
+		return nil, status.Errorf(codes.AlreadyExists, "tenant name is already taken")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return getTenantResponse(tenant, 0), nil
+}
+
+// RenameTenant changes the name of a tenant
+func (s *Server) RenameTenant(ctx context.Context, req *pbUser.TenantRenameRequest) (*pbUser.TenantResponse, error) {
+	name := strings.TrimSpace(req.Name)
+
+	if name == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "argument name is required")
+	}
+
+	tenant := new(model.Tenant)
+
+	res, err := s.db.NewUpdate().
+		Model(tenant).
+		Set("name = ?", name).
+		Set("updated_at = ?", time.Now().UTC()).
+		Where("id = ?", req.Id).
+		Returning("*").
+		Exec(ctx)
+
+	if isUniqueViolation(err) {
+		return nil, status.Errorf(codes.AlreadyExists, "tenant name is already taken")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return nil, status.Errorf(codes.NotFound, "tenant not found")
+	}
+
+	return s.getTenant(ctx, tenant)
+}
+
+// ActivateTenant lets the users of a tenant use the API again
+func (s *Server) ActivateTenant(ctx context.Context, req *pbUser.TenantRequest) (*pbUser.TenantResponse, error) {
+	return s.setTenantActive(ctx, req.Id, true)
+}
+
+// DeactivateTenant refuses every request of the users of a tenant until it
+// is activated again. The users and their data are kept.
+func (s *Server) DeactivateTenant(ctx context.Context, req *pbUser.TenantRequest) (*pbUser.TenantResponse, error) {
+	return s.setTenantActive(ctx, req.Id, false)
+}
+
+func (s *Server) setTenantActive(ctx context.Context, id int32, active bool) (*pbUser.TenantResponse, error) {
+	tenant := new(model.Tenant)
+
+	res, err := s.db.NewUpdate().
+		Model(tenant).
+		Set("active = ?", active).
+		Set("updated_at = ?", time.Now().UTC()).
+		Where("id = ?", id).
+		Returning("*").
+		Exec(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return nil, status.Errorf(codes.NotFound, "tenant not found")
+	}
+
+	s.cache.InvalidateTenant(id)
+
+	return s.getTenant(ctx, tenant)
+}
+
+// ListTenants lists tenants by name with the number of users in each,
+// optionally only the active or inactive ones
+func (s *Server) ListTenants(ctx context.Context, req *pbUser.TenantListRequest) (*pbUser.TenantListResponse, error) {
+	var tenants []model.Tenant
+
+	q := s.db.NewSelect().
+		Model(&tenants).
+		Order("name ASC")
+
+	if req.Active != nil {
+		q.Where("active = ?", *req.Active)
+	}
+
+	if err := q.Scan(ctx); err != nil {
+		return nil, err
+	}
+
+	ids := make([]int32, len(tenants))
+
+	for i, tenant := range tenants {
+		ids[i] = tenant.ID
+	}
+
+	counts, err := tenantUserCounts(ctx, s.db, ids)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var results pbUser.TenantListResponse
+
+	for i := range tenants {
+		results.Tenants = append(results.Tenants, getTenantResponse(&tenants[i], counts[tenants[i].ID]))
+	}
+
+	return &results, nil
+}
+
+// getTenant returns the response of a tenant with its user count
+func (s *Server) getTenant(ctx context.Context, tenant *model.Tenant) (*pbUser.TenantResponse, error) {
+	counts, err := tenantUserCounts(ctx, s.db, []int32{tenant.ID})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return getTenantResponse(tenant, counts[tenant.ID]), nil
+}
+
+// tenantUserCounts counts the users, not deleted, of each of tenant ids
+func tenantUserCounts(ctx context.Context, db bun.IDB, ids []int32) (map[int32]int64, error) {
+	counts := make(map[int32]int64, len(ids))
+
+	if len(ids) == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		TenantID int32
+		Users    int64
+	}
+
+	err := db.NewSelect().
+		Model((*model.User)(nil)).
+		ColumnExpr("tenant_id").
+		ColumnExpr("count(*) AS users").
+		Where("tenant_id IN (?)", bun.In(ids)).
+		Group("tenant_id").
+		Scan(ctx, &rows)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		counts[row.TenantID] = row.Users
+	}
+
+	return counts, nil
+}
+
+// checkTenantExists returns an InvalidArgument error when id is neither 0,
+// meaning no tenant, nor the id of a tenant
+func checkTenantExists(ctx context.Context, db bun.IDB, id int32) error {
+	if id == 0 {
+		return nil
+	}
+
+	exists, err := db.NewSelect().
+		Model((*model.Tenant)(nil)).
+		Where("id = ?", id).
+		Exists(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return status.Errorf(codes.InvalidArgument, "tenant %d does not exist", id)
+	}
+
+	return nil
+}
+
+func getTenantResponse(tenant *model.Tenant, userCount int64) *pbUser.TenantResponse {
+	response := &pbUser.TenantResponse{
+		Id:        tenant.ID,
+		Name:      tenant.Name,
+		Active:    tenant.Active,
+		UserCount: userCount,
+		CreatedAt: tenant.CreatedAt.UTC().Format(time.RFC3339),
+	}
+
+	if !tenant.UpdatedAt.IsZero() {
+		response.UpdatedAt = tenant.UpdatedAt.UTC().Format(time.RFC3339)
+	}
+
+	return response
+}
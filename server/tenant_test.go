@@ -0,0 +1,87 @@
+package server_test
+
+import (
+	"github.com/resonatecoop/user-api-template/model"
+
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (suite *UserApiTestSuite) TestTenants() {
+	ctx := suite.ctx
+
+	tenant, err := suite.server.CreateTenant(ctx, &pbUser.TenantCreateRequest{Name: " Test Tenant "})
+	if err != nil {
+		panic(err)
+	}
+
+	defer suite.db.NewDelete().
+		Model((*model.Tenant)(nil)).
+		Where("id = ?", tenant.Id).
+		Exec(ctx)
+
+	assert.Equal(suite.T(), "Test Tenant", tenant.Name)
+	assert.True(suite.T(), tenant.Active)
+
+	_, err = suite.server.CreateTenant(ctx, &pbUser.TenantCreateRequest{Name: "Test Tenant"})
+	assert.Equal(suite.T(), codes.AlreadyExists, status.Code(err))
+
+	added, err := suite.server.AddUser(ctx, &pbUser.UserAddRequest{
+		Username: "tenant.user@user.com",
+		FullName: "Tenant User",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	missing := int32(-1)
+
+	_, err = suite.server.UpdateUserRestricted(ctx, &pbUser.UserUpdateRestrictedRequest{Id: added.Id, TenantId: &missing})
+	assert.Equal(suite.T(), codes.InvalidArgument, status.Code(err))
+
+	_, err = suite.server.UpdateUserRestricted(ctx, &pbUser.UserUpdateRestrictedRequest{Id: added.Id, TenantId: &tenant.Id})
+	if err != nil {
+		panic(err)
+	}
+
+	renamed, err := suite.server.RenameTenant(ctx, &pbUser.TenantRenameRequest{Id: tenant.Id, Name: "Renamed Tenant"})
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(suite.T(), "Renamed Tenant", renamed.Name)
+	assert.Equal(suite.T(), int64(1), renamed.UserCount)
+
+	deactivated, err := suite.server.DeactivateTenant(ctx, &pbUser.TenantRequest{Id: tenant.Id})
+	if err != nil {
+		panic(err)
+	}
+	assert.False(suite.T(), deactivated.Active)
+
+	active := false
+
+	list, err := suite.server.ListTenants(ctx, &pbUser.TenantListRequest{Active: &active})
+	if err != nil {
+		panic(err)
+	}
+
+	found := false
+
+	for _, t := range list.Tenants {
+		if t.Id == tenant.Id {
+			found = true
+			assert.Equal(suite.T(), int64(1), t.UserCount)
+		}
+	}
+	assert.True(suite.T(), found)
+
+	activated, err := suite.server.ActivateTenant(ctx, &pbUser.TenantRequest{Id: tenant.Id})
+	if err != nil {
+		panic(err)
+	}
+	assert.True(suite.T(), activated.Active)
+
+	_, err = suite.server.ActivateTenant(ctx, &pbUser.TenantRequest{Id: missing})
+	assert.Equal(suite.T(), codes.NotFound, status.Code(err))
+}
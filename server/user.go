@@ -9,12 +9,24 @@ import (
 	"time"
 
 	uuid "github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"google.golang.org/grpc/codes"
+	grpclog "google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/status"
+
+	"github.com/resonatecoop/user-api-template/authorization"
+	"github.com/resonatecoop/user-api-template/internal/pkg/pagination"
 	uuidpkg "github.com/resonatecoop/user-api-template/pkg/uuid"
 
 	"github.com/resonatecoop/user-api-template/model"
 	pbUser "github.com/resonatecoop/user-api-template/proto/user"
 )
 
+const (
+	defaultUserPageSize = 50
+	maxUserPageSize     = 500
+)
+
 // AddUser adds a user to the DB
 func (s *Server) AddUser(ctx context.Context, user *pbUser.UserAddRequest) (*pbUser.UserRequest, error) {
 	err := checkRequiredAddAttributes(user)
@@ -22,18 +34,25 @@ func (s *Server) AddUser(ctx context.Context, user *pbUser.UserAddRequest) (*pbU
 		return nil, err
 	}
 
-	err = s.db.NewSelect().Model(&model.User{}).
-		Where("username = ?", strings.ToLower(user.Username)).
-		Scan(ctx)
+	if user.Member {
+		return nil, status.Errorf(codes.InvalidArgument, "member is derived from memberships, use GrantMembership")
+	}
 
-	if err == nil {
-		return nil, errors.New("Email is taken")
+	if err = checkUsernameAvailable(ctx, s.db, strings.ToLower(user.Username), uuid.Nil.String()); err != nil {
+		return nil, err
 	}
 
 	var thisRole int32
 
-	// if requested role is not admin, grant it
-	if user.RoleId != nil && *user.RoleId >= int32(model.LabelRole) {
+	if authorization.AuthUserFromContext(ctx) != nil && user.RoleId != nil {
+		// users added by an authenticated requestor are held to the role
+		// assignment policy
+		if err = s.checkRoleAssignment(ctx, uuid.Nil, 0, *user.RoleId); err != nil {
+			return nil, err
+		}
+		thisRole = *user.RoleId
+	} else if user.RoleId != nil && *user.RoleId >= int32(model.LabelRole) {
+		// if requested role is not admin, grant it
 		thisRole = *user.RoleId
 	} else {
 
@@ -51,6 +70,19 @@ func (s *Server) AddUser(ctx context.Context, user *pbUser.UserAddRequest) (*pbU
 		thisRole = int32(defaultRole.ID)
 	}
 
+	followedGroups, err := validateFollowedGroups(ctx, s.db, user.FollowedGroups)
+	if err != nil {
+		return nil, err
+	}
+
+	var residenceAddress map[string]string
+
+	if user.ResidenceAddress != nil {
+		if residenceAddress, err = validateResidenceAddress(user.ResidenceAddress); err != nil {
+			return nil, err
+		}
+	}
+
 	// defaults to User Role, must update with greater privileges to change role
 	newUser := &model.User{
 		Username:               strings.ToLower(user.Username),
@@ -58,28 +90,48 @@ func (s *Server) AddUser(ctx context.Context, user *pbUser.UserAddRequest) (*pbU
 		FullName:               user.FullName,
 		FirstName:              user.FirstName,
 		LastName:               user.LastName,
-		Member:                 user.Member,
 		Country:                user.Country,
 		NewsletterNotification: user.NewsletterNotification,
+		FollowedGroups:         followedGroups,
 	}
 
 	newUser.ID = uuid.Must(uuid.NewRandom())
 
-	_, err = s.db.NewInsert().
-		Column(
-			"id",
-			"username",
-			"full_name",
-			"first_name",
-			"last_name",
-			"role_id",
-			"tenant_id",
-			"member",
-			"country",
-			"newsletter_notification",
-		).
-		Model(newUser).
-		Exec(ctx)
+	err = s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if residenceAddress != nil {
+			address, err := insertResidenceAddress(ctx, tx, residenceAddress)
+
+			if err != nil {
+				return err
+			}
+
+			newUser.ResidenceAddressID = address.ID
+		}
+
+		_, err := tx.NewInsert().
+			Column(
+				"id",
+				"username",
+				"full_name",
+				"first_name",
+				"last_name",
+				"role_id",
+				"tenant_id",
+				"country",
+				"newsletter_notification",
+				"followed_groups",
+				"residence_address_id",
+			).
+			Model(newUser).
+			Exec(ctx)
+
+		return err
+	})
+
+	// a concurrent signup took the username since checking it
+	if isUniqueViolation(err) {
+		return nil, status.Errorf(codes.AlreadyExists, "username is already taken")
+	}
 
 	if err != nil {
 		return nil, err
@@ -87,8 +139,8 @@ func (s *Server) AddUser(ctx context.Context, user *pbUser.UserAddRequest) (*pbU
 
 	res := &pbUser.UserRequest{Id: newUser.ID.String()}
 
-	if err != nil {
-		return nil, err
+	if err = s.sendEmailConfirmation(ctx, newUser.ID, newUser.Username); err != nil {
+		grpclog.Errorf("[user-api] sending email confirmation to user %s failed: %v", newUser.ID, err)
 	}
 
 	return res, nil
@@ -97,6 +149,10 @@ func (s *Server) AddUser(ctx context.Context, user *pbUser.UserAddRequest) (*pbU
 // GetUser Gets a user from the DB
 func (s *Server) GetUser(ctx context.Context, user *pbUser.UserRequest) (*pbUser.UserPublicResponse, error) {
 
+	if err := s.authorizeUser(ctx, s.db, user.Id); err != nil {
+		return nil, err
+	}
+
 	u := new(model.User)
 
 	err := s.db.NewSelect().Model(u).
@@ -108,55 +164,193 @@ func (s *Server) GetUser(ctx context.Context, user *pbUser.UserRequest) (*pbUser
 		return nil, err
 	}
 
+	owned, err := loadOwnedGroups(ctx, s.db, []uuid.UUID{u.ID})
+
+	if err != nil {
+		return nil, err
+	}
+
+	groups := owned[u.ID]
+
+	if groups == nil {
+		groups = new(userOwnedGroups)
+	}
+
+	members, err := loadActiveMembers(ctx, s.db, []uuid.UUID{u.ID})
+
+	if err != nil {
+		return nil, err
+	}
+
+	setETag(ctx, u.Version)
+
 	return &pbUser.UserPublicResponse{
 		Id:             u.ID.String(),
 		Username:       u.Username,
 		FullName:       u.FullName,
 		FirstName:      u.FirstName,
 		LastName:       u.LastName,
-		Member:         u.Member,
+		Member:         members[u.ID],
 		Country:        u.Country,
 		FollowedGroups: uuidpkg.ConvertUUIDToStrArray(u.FollowedGroups),
+		Personas:       groups.Personas,
+		OwnedGroups:    groups.OwnedGroups,
+		Version:        u.Version,
 	}, nil
 }
 
 // GetUserRestricted intended for privileged roles only supplies more detailed, private info about user.
 func (s *Server) GetUserRestricted(ctx context.Context, user *pbUser.UserRequest) (*pbUser.UserPrivateResponse, error) {
 
+	if err := s.authorizeUser(ctx, s.db, user.Id); err != nil {
+		return nil, err
+	}
+
 	u := new(model.User)
 
 	err := s.db.NewSelect().Model(u).
 		Column("user.*").
-		Where("id = ?", user.Id).
+		Relation("ResidenceAddress").
+		Where("user.id = ?", user.Id).
 		Scan(ctx)
 
 	if err != nil {
 		return nil, err
 	}
 
+	owned, err := loadOwnedGroups(ctx, s.db, []uuid.UUID{u.ID})
+
+	if err != nil {
+		return nil, err
+	}
+
+	groups := owned[u.ID]
+
+	if groups == nil {
+		groups = new(userOwnedGroups)
+	}
+
+	members, err := loadActiveMembers(ctx, s.db, []uuid.UUID{u.ID})
+
+	if err != nil {
+		return nil, err
+	}
+
+	setETag(ctx, u.Version)
+
 	return &pbUser.UserPrivateResponse{
 		Id:                     u.ID.String(),
 		Username:               u.Username,
 		FullName:               u.FullName,
 		FirstName:              u.FirstName,
 		LastName:               u.LastName,
-		Member:                 u.Member,
+		Member:                 members[u.ID],
 		RoleId:                 u.RoleID,
 		TenantId:               u.TenantID,
 		FollowedGroups:         uuidpkg.ConvertUUIDToStrArray(u.FollowedGroups),
 		NewsletterNotification: u.NewsletterNotification,
+		Version:                u.Version,
+		PendingUsername:        u.PendingUsername,
+		ResidenceAddress:       getStreetAddressResponse(u.ResidenceAddress),
+		Personas:               groups.Personas,
+		OwnedGroups:            groups.OwnedGroups,
 	}, nil
 }
 
-// DeleteUser Deletes a user from the DB
+// DeleteUser soft deletes a user and the user groups they own. Both can be
+// restored with RestoreUser until the deletion grace period expires.
 func (s *Server) DeleteUser(ctx context.Context, user *pbUser.UserRequest) (*pbUser.Empty, error) {
-	u := new(model.User)
+	if err := s.authorizeUser(ctx, s.db, user.Id); err != nil {
+		return nil, err
+	}
 
-	_, err := s.db.NewDelete().
-		Model(u).
-		Where("id = ?", user.Id).
+	err := s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		return softDeleteUser(ctx, tx, user.Id, time.Now().UTC())
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.invalidateAuthUser(user.Id)
+
+	return &pbUser.Empty{}, nil
+}
+
+// softDeleteUser marks a user and the user groups they own as deleted at deletedAt
+func softDeleteUser(ctx context.Context, tx bun.Tx, id string, deletedAt time.Time) error {
+	res, err := tx.NewUpdate().
+		Model((*model.User)(nil)).
+		Set("deleted_at = ?", deletedAt).
+		Where("id = ?", id).
+		Exec(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if number, _ := res.RowsAffected(); number == 0 {
+		return status.Errorf(codes.NotFound, "user not found")
+	}
+
+	// groups deleted alongside their owner share the owner's deleted_at,
+	// which is how RestoreUser tells them apart from groups deleted earlier
+	_, err = tx.NewUpdate().
+		Model((*model.UserGroup)(nil)).
+		Set("deleted_at = ?", deletedAt).
+		Where("owner_id = ?", id).
 		Exec(ctx)
 
+	return err
+}
+
+// RestoreUser restores a soft deleted user and the user groups deleted with them
+func (s *Server) RestoreUser(ctx context.Context, user *pbUser.UserRequest) (*pbUser.Empty, error) {
+	if err := s.authorizeUser(ctx, s.db, user.Id); err != nil {
+		return nil, err
+	}
+
+	err := s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		deleted := new(model.User)
+
+		err := tx.NewSelect().
+			Model(deleted).
+			WhereDeleted().
+			Where("id = ?", user.Id).
+			For("UPDATE").
+			Scan(ctx)
+
+		if err != nil {
+			return status.Errorf(codes.NotFound, "deleted user not found")
+		}
+
+		if time.Now().UTC().After(deleted.DeletedAt.Add(s.deletionGracePeriod())) {
+			return status.Errorf(codes.FailedPrecondition, "deletion grace period has expired")
+		}
+
+		_, err = tx.NewUpdate().
+			Model((*model.User)(nil)).
+			Set("deleted_at = NULL").
+			Set("updated_at = ?", time.Now().UTC()).
+			WhereAllWithDeleted().
+			Where("id = ?", deleted.ID).
+			Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewUpdate().
+			Model((*model.UserGroup)(nil)).
+			Set("deleted_at = NULL").
+			WhereAllWithDeleted().
+			Where("owner_id = ?", deleted.ID).
+			Where("deleted_at = ?", deleted.DeletedAt).
+			Exec(ctx)
+
+		return err
+	})
+
 	if err != nil {
 		return nil, err
 	}
@@ -164,20 +358,124 @@ func (s *Server) DeleteUser(ctx context.Context, user *pbUser.UserRequest) (*pbU
 	return &pbUser.Empty{}, nil
 }
 
+// ListDeletedUsers lists a page of soft deleted users, most recently deleted first
+func (s *Server) ListDeletedUsers(ctx context.Context, req *pbUser.DeletedUserListRequest) (*pbUser.DeletedUserListResponse, error) {
+
+	var users []model.User
+	var results pbUser.DeletedUserListResponse
+
+	pageSize := pagination.PageSize(req.PageSize, defaultUserPageSize, maxUserPageSize)
+
+	q := s.db.NewSelect().
+		Model(&users).
+		WhereDeleted()
+
+	if filter := tenantFilter(ctx); filter != "" {
+		q.Where(filter)
+	}
+
+	if req.PageToken != "" {
+		cursor, err := pagination.Decode(req.PageToken)
+
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "page_token is not valid")
+		}
+
+		deletedAt, err := time.Parse(time.RFC3339Nano, cursor.Key)
+
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "page_token is not valid")
+		}
+
+		q.Where("(user.deleted_at, user.id) < (?, ?)", deletedAt, cursor.ID)
+	}
+
+	err := q.
+		OrderExpr("user.deleted_at DESC, user.id DESC").
+		Limit(pageSize + 1).
+		Scan(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(users) > pageSize {
+		users = users[:pageSize]
+
+		last := users[pageSize-1]
+
+		results.NextPageToken = pagination.Encode(&pagination.Cursor{
+			Key: last.DeletedAt.UTC().Format(time.RFC3339Nano),
+			ID:  last.ID,
+		})
+	}
+
+	for i := range users {
+		results.User = append(results.User, &pbUser.DeletedUserResponse{
+			User:       getUserPrivateResponse(&users[i]),
+			DeletedAt:  users[i].DeletedAt.UTC().Format(time.RFC3339),
+			PurgeAfter: users[i].DeletedAt.Add(s.deletionGracePeriod()).UTC().Format(time.RFC3339),
+		})
+	}
+
+	return &results, nil
+}
+
 // UpdateUser updates a users basic attributes
 func (s *Server) UpdateUser(ctx context.Context, UserUpdateRequest *pbUser.UserUpdateRequest) (*pbUser.Empty, error) {
 
+	version, err := requiredVersion(ctx, UserUpdateRequest.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.authorizeUser(ctx, s.db, UserUpdateRequest.Id); err != nil {
+		return nil, err
+	}
+
+	if err = checkVersion(ctx, s.db, "users", UserUpdateRequest.Id, version); err != nil {
+		return nil, err
+	}
+
 	var updatedUserValues = make(map[string]interface{})
 
+	current := new(model.User)
+	var pendingUsername string
+
 	if UserUpdateRequest.Username != nil {
-		updatedUserValues["username"] = *UserUpdateRequest.Username
+		pendingUsername = normalizeUsername(*UserUpdateRequest.Username)
 		re := regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
-		if !re.MatchString(*UserUpdateRequest.Username) {
+		if !re.MatchString(pendingUsername) {
 			return nil, errors.New("username must be a valid email")
 		}
+
+		err = s.db.NewSelect().
+			Model(current).
+			Column("id", "username").
+			Where("id = ?", UserUpdateRequest.Id).
+			Scan(ctx)
+
+		if err != nil {
+			return nil, status.Errorf(codes.NotFound, "user not found")
+		}
+
+		if err = checkUsernameAvailable(ctx, s.db, pendingUsername, UserUpdateRequest.Id); err != nil {
+			return nil, err
+		}
+
+		// the username only changes once the new address is confirmed,
+		// asking for the current one cancels a pending change
+		if pendingUsername == current.Username {
+			updatedUserValues["pending_username"] = nil
+		} else {
+			updatedUserValues["pending_username"] = pendingUsername
+		}
 	}
 
 	if UserUpdateRequest.RoleId != nil && *UserUpdateRequest.RoleId >= int32(model.LabelRole) {
+		if err = s.authorizeRoleChange(ctx, s.db, UserUpdateRequest.Id, *UserUpdateRequest.RoleId); err != nil {
+			return nil, err
+		}
 		updatedUserValues["role_id"] = *UserUpdateRequest.RoleId
 	}
 	if UserUpdateRequest.FirstName != nil {
@@ -193,18 +491,65 @@ func (s *Server) UpdateUser(ctx context.Context, UserUpdateRequest *pbUser.UserU
 		updatedUserValues["newsletter_notification"] = *UserUpdateRequest.NewsletterNotification
 	}
 
+	var residenceAddress map[string]string
+
+	if UserUpdateRequest.ResidenceAddress != nil {
+		if residenceAddress, err = validateResidenceAddress(UserUpdateRequest.ResidenceAddress); err != nil {
+			return nil, err
+		}
+	}
+
 	updatedUserValues["updated_at"] = time.Now().UTC()
 
-	rows, err := s.db.NewUpdate().Model(&updatedUserValues).TableExpr("users").Where("id = ?", UserUpdateRequest.Id).Exec(ctx)
+	err = s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var detachedAddress uuid.UUID
+
+		if UserUpdateRequest.ResidenceAddress != nil {
+			addressID, detached, err := writeResidenceAddress(ctx, tx, UserUpdateRequest.Id, residenceAddress)
+
+			if err != nil {
+				return err
+			}
+
+			updatedUserValues["residence_address_id"] = addressID
+			detachedAddress = detached
+		}
+
+		q := tx.NewUpdate().Model(&updatedUserValues).TableExpr("users").Where("id = ?", UserUpdateRequest.Id)
+
+		if version != nil {
+			q.Where("version = ?", *version)
+		}
+
+		rows, err := q.Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		number, _ := rows.RowsAffected()
+
+		if number == 0 {
+			// the record may have changed since it was checked
+			if err = checkVersion(ctx, tx, "users", UserUpdateRequest.Id, version); err != nil {
+				return err
+			}
+			return errors.New("warning: no rows were updated")
+		}
+
+		return deleteStreetAddress(ctx, tx, detachedAddress)
+	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	number, _ := rows.RowsAffected()
+	if _, ok := updatedUserValues["role_id"]; ok {
+		s.invalidateAuthUser(UserUpdateRequest.Id)
+	}
 
-	if number == 0 {
-		return nil, errors.New("warning: no rows were updated")
+	if pendingUsername != "" && pendingUsername != current.Username {
+		s.sendEmailChange(ctx, UserUpdateRequest.Id, current.Username, pendingUsername)
 	}
 
 	return &pbUser.Empty{}, nil
@@ -213,14 +558,32 @@ func (s *Server) UpdateUser(ctx context.Context, UserUpdateRequest *pbUser.UserU
 // UpdateUserRestricted updates a users more restricted attributes
 func (s *Server) UpdateUserRestricted(ctx context.Context, UserUpdateRestrictedRequest *pbUser.UserUpdateRestrictedRequest) (*pbUser.Empty, error) {
 
+	version, err := requiredVersion(ctx, UserUpdateRestrictedRequest.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.authorizeUser(ctx, s.db, UserUpdateRestrictedRequest.Id); err != nil {
+		return nil, err
+	}
+
+	if err = checkVersion(ctx, s.db, "users", UserUpdateRestrictedRequest.Id, version); err != nil {
+		return nil, err
+	}
+
 	var updatedUserValues = make(map[string]interface{})
 
+	var username string
+
 	if UserUpdateRestrictedRequest.Username != nil {
-		updatedUserValues["username"] = *UserUpdateRestrictedRequest.Username
+		username = normalizeUsername(*UserUpdateRestrictedRequest.Username)
 		re := regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
-		if !re.MatchString(*UserUpdateRestrictedRequest.Username) {
+		if !re.MatchString(username) {
 			return nil, errors.New("username must be a valid email")
 		}
+		if err = checkUsernameAvailable(ctx, s.db, username, UserUpdateRestrictedRequest.Id); err != nil {
+			return nil, err
+		}
 	}
 	if UserUpdateRestrictedRequest.FirstName != nil {
 		updatedUserValues["first_name"] = *UserUpdateRestrictedRequest.FirstName
@@ -232,67 +595,298 @@ func (s *Server) UpdateUserRestricted(ctx context.Context, UserUpdateRestrictedR
 		updatedUserValues["full_name"] = *UserUpdateRestrictedRequest.FullName
 	}
 	if UserUpdateRestrictedRequest.Member != nil {
-		updatedUserValues["member"] = *UserUpdateRestrictedRequest.Member
+		return nil, status.Errorf(codes.InvalidArgument, "member is derived from memberships, use GrantMembership or LapseMembership")
 	}
 	if UserUpdateRestrictedRequest.RoleId != nil {
+		if err = s.authorizeRoleChange(ctx, s.db, UserUpdateRestrictedRequest.Id, *UserUpdateRestrictedRequest.RoleId); err != nil {
+			return nil, err
+		}
 		updatedUserValues["role_id"] = *UserUpdateRestrictedRequest.RoleId
 	}
 	if UserUpdateRestrictedRequest.TenantId != nil {
+		// tenant admins can't move users out of their tenant
+		if err = s.authorizeTenant(ctx, *UserUpdateRestrictedRequest.TenantId); err != nil {
+			return nil, err
+		}
+		if err = checkTenantExists(ctx, s.db, *UserUpdateRestrictedRequest.TenantId); err != nil {
+			return nil, err
+		}
 		updatedUserValues["tenant_id"] = *UserUpdateRestrictedRequest.TenantId
 	}
 	if UserUpdateRestrictedRequest.NewsletterNotification != nil {
 		updatedUserValues["newsletter_notification"] = *UserUpdateRestrictedRequest.NewsletterNotification
 	}
 
+	var residenceAddress map[string]string
+
+	if UserUpdateRestrictedRequest.ResidenceAddress != nil {
+		if residenceAddress, err = validateResidenceAddress(UserUpdateRestrictedRequest.ResidenceAddress); err != nil {
+			return nil, err
+		}
+	}
+
 	updatedUserValues["updated_at"] = time.Now().UTC()
 
-	rows, err := s.db.NewUpdate().Model(&updatedUserValues).TableExpr("users").Where("id = ?", UserUpdateRestrictedRequest.Id).Exec(ctx)
+	usernameChanged := false
+
+	err = s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var detachedAddress uuid.UUID
+
+		if UserUpdateRestrictedRequest.ResidenceAddress != nil {
+			addressID, detached, err := writeResidenceAddress(ctx, tx, UserUpdateRestrictedRequest.Id, residenceAddress)
+
+			if err != nil {
+				return err
+			}
+
+			updatedUserValues["residence_address_id"] = addressID
+			detachedAddress = detached
+		}
+
+		q := tx.NewUpdate().Model(&updatedUserValues).TableExpr("users").Where("id = ?", UserUpdateRestrictedRequest.Id)
+
+		if version != nil {
+			q.Where("version = ?", *version)
+		}
+
+		rows, err := q.Exec(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		number, _ := rows.RowsAffected()
+
+		if number == 0 {
+			// the record may have changed since it was checked
+			if err = checkVersion(ctx, tx, "users", UserUpdateRestrictedRequest.Id, version); err != nil {
+				return err
+			}
+			return errors.New("warning: no rows were updated")
+		}
+
+		if err = deleteStreetAddress(ctx, tx, detachedAddress); err != nil {
+			return err
+		}
+
+		if username == "" {
+			return nil
+		}
+
+		u := new(model.User)
+
+		err = tx.NewSelect().
+			Model(u).
+			Column("id", "username").
+			Where("id = ?", UserUpdateRestrictedRequest.Id).
+			For("UPDATE").
+			Scan(ctx)
+
+		if err != nil || u.Username == username {
+			return err
+		}
+
+		// admins change usernames straight away, the new one still has to be confirmed
+		usernameChanged = true
+
+		return changeUsername(ctx, tx, u, username, model.UsernameChangeAdmin)
+	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	number, _ := rows.RowsAffected()
+	if UserUpdateRestrictedRequest.RoleId != nil || UserUpdateRestrictedRequest.TenantId != nil || usernameChanged {
+		s.invalidateAuthUser(UserUpdateRestrictedRequest.Id)
+	}
 
-	if number == 0 {
-		return nil, errors.New("warning: no rows were updated")
+	if usernameChanged {
+		s.resendEmailConfirmation(ctx, UserUpdateRestrictedRequest.Id, username)
 	}
 
 	return &pbUser.Empty{}, nil
 }
 
-// ListUsers lists all users in the store.
-func (s *Server) ListUsers(ctx context.Context, Empty *pbUser.Empty) (*pbUser.UserListResponse, error) {
+// ListUsers lists a page of users in the store, filtered and sorted as requested.
+func (s *Server) ListUsers(ctx context.Context, req *pbUser.UserListRequest) (*pbUser.UserListResponse, error) {
 
 	var users []model.User
 	var results pbUser.UserListResponse
 
-	err := s.db.NewSelect().
+	orderBy := req.OrderBy
+
+	if orderBy == "" {
+		orderBy = "created_at"
+	}
+
+	column := strings.TrimPrefix(orderBy, "-")
+	descending := column != orderBy
+
+	if column != "created_at" && column != "updated_at" && column != "username" {
+		return nil, status.Errorf(codes.InvalidArgument, "order_by must be one of created_at, updated_at or username")
+	}
+
+	pageSize := pagination.PageSize(req.PageSize, defaultUserPageSize, maxUserPageSize)
+
+	if req.TenantId != nil {
+		if err := s.authorizeTenant(ctx, *req.TenantId); err != nil {
+			return nil, err
+		}
+	}
+
+	q := s.db.NewSelect().
 		Model(&users).
+		Relation("ResidenceAddress")
+
+	if filter := tenantFilter(ctx); filter != "" {
+		q.Where(filter)
+	}
+
+	if err := applyUserListFilters(q, req); err != nil {
+		return nil, err
+	}
+
+	if req.PageToken != "" {
+		cursor, err := pagination.Decode(req.PageToken)
+
+		if err != nil || cursor.OrderBy != orderBy {
+			return nil, status.Errorf(codes.InvalidArgument, "page_token is not valid for this query")
+		}
+
+		var key interface{} = cursor.Key
+
+		if column != "username" {
+			key, err = time.Parse(time.RFC3339Nano, cursor.Key)
+
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "page_token is not valid for this query")
+			}
+		}
+
+		op := ">"
+
+		if descending {
+			op = "<"
+		}
+
+		q.Where("(?, ?) "+op+" (?, ?)", bun.Ident("user."+column), bun.Ident("user.id"), key, cursor.ID)
+	}
+
+	direction := "ASC"
+
+	if descending {
+		direction = "DESC"
+	}
+
+	err := q.
+		OrderExpr("? "+direction+", ? "+direction, bun.Ident("user."+column), bun.Ident("user.id")).
+		Limit(pageSize + 1).
 		Scan(ctx)
 
 	if err != nil {
 		return nil, err
 	}
 
-	for _, user := range users {
-		var result pbUser.UserPrivateResponse
-		result.Id = uuid.UUID.String(user.ID)
-		result.Username = user.Username
-		result.FullName = user.FullName
-		result.FirstName = user.FirstName
-		result.LastName = user.LastName
-		result.Member = user.Member
-		result.RoleId = user.RoleID
-		result.TenantId = user.TenantID
-		result.NewsletterNotification = user.NewsletterNotification
-		result.FollowedGroups = uuidpkg.ConvertUUIDToStrArray(user.FollowedGroups)
-		results.User = append(results.User, &result)
+	if len(users) > pageSize {
+		users = users[:pageSize]
+
+		last := users[pageSize-1]
+
+		cursor := &pagination.Cursor{OrderBy: orderBy, ID: last.ID}
+
+		switch column {
+		case "created_at":
+			cursor.Key = last.CreatedAt.UTC().Format(time.RFC3339Nano)
+		case "updated_at":
+			cursor.Key = last.UpdatedAt.UTC().Format(time.RFC3339Nano)
+		default:
+			cursor.Key = last.Username
+		}
+
+		results.NextPageToken = pagination.Encode(cursor)
+	}
+
+	for i := range users {
+		results.User = append(results.User, getUserPrivateResponse(&users[i]))
+	}
+
+	if err = setPrivateOwnedGroups(ctx, s.db, results.User); err != nil {
+		return nil, err
+	}
+
+	if err = setPrivateMembers(ctx, s.db, results.User); err != nil {
+		return nil, err
 	}
 
 	return &results, nil
 }
 
+// applyUserListFilters narrows a user select query to the filters set on the request
+func applyUserListFilters(q *bun.SelectQuery, req *pbUser.UserListRequest) error {
+	if req.RoleId != nil {
+		q.Where("user.role_id = ?", *req.RoleId)
+	}
+	if req.TenantId != nil {
+		q.Where("user.tenant_id = ?", *req.TenantId)
+	}
+	if req.Country != nil {
+		q.Where("user.country = ?", *req.Country)
+	}
+	if req.Member != nil {
+		q.Where("("+activeMembershipExpr+") = ?", *req.Member)
+	}
+	if req.NewsletterNotification != nil {
+		q.Where("user.newsletter_notification = ?", *req.NewsletterNotification)
+	}
+
+	ranges := []struct {
+		argument string
+		value    string
+		where    string
+	}{
+		{"created_after", req.CreatedAfter, "user.created_at >= ?"},
+		{"created_before", req.CreatedBefore, "user.created_at < ?"},
+		{"updated_after", req.UpdatedAfter, "user.updated_at >= ?"},
+		{"updated_before", req.UpdatedBefore, "user.updated_at < ?"},
+	}
+
+	for _, r := range ranges {
+		if r.value == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, r.value)
+
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "argument %v must be an RFC 3339 timestamp", r.argument)
+		}
+
+		q.Where(r.where, t.UTC())
+	}
+
+	return nil
+}
+
+func getUserPrivateResponse(user *model.User) *pbUser.UserPrivateResponse {
+	return &pbUser.UserPrivateResponse{
+		Id:                     user.ID.String(),
+		Username:               user.Username,
+		FullName:               user.FullName,
+		FirstName:              user.FirstName,
+		LastName:               user.LastName,
+		Country:                user.Country,
+		EmailConfirmed:         user.EmailConfirmed,
+		Member:                 user.Member,
+		RoleId:                 user.RoleID,
+		TenantId:               user.TenantID,
+		NewsletterNotification: user.NewsletterNotification,
+		FollowedGroups:         uuidpkg.ConvertUUIDToStrArray(user.FollowedGroups),
+		Version:                user.Version,
+		PendingUsername:        user.PendingUsername,
+		ResidenceAddress:       getStreetAddressResponse(user.ResidenceAddress),
+	}
+}
+
 func checkRequiredAddAttributes(user *pbUser.UserAddRequest) error {
 	if user.Username == "" {
 		argument := "username"
@@ -2,12 +2,18 @@ package server_test
 
 import (
 	"fmt"
+	"time"
 
+	uuid "github.com/google/uuid"
 	"github.com/resonatecoop/user-api-template/model"
+	"github.com/resonatecoop/user-api-template/server"
 
 	_ "github.com/jackc/pgx/v4/stdlib"
 	pbUser "github.com/resonatecoop/user-api-template/proto/user"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 // type UserApiTestSuite struct {
@@ -68,7 +74,7 @@ func (suite *UserApiTestSuite) TestDeleteUser() {
 	}
 
 	var response *pbUser.UserListResponse
-	var empty *pbUser.Empty
+	empty := &pbUser.UserListRequest{}
 
 	response, err := suite.server.ListUsers(ctx, empty)
 	if err != nil {
@@ -98,6 +104,13 @@ func (suite *UserApiTestSuite) TestDeleteUser() {
 		panic(err)
 	}
 
+	// usernames are unique whatever their case
+	_, err = suite.server.AddUser(ctx, &pbUser.UserAddRequest{
+		Username: "Joe@Bloggs.com",
+		FullName: "Joe Bloggs",
+	})
+	assert.Equal(suite.T(), codes.AlreadyExists, status.Code(err))
+
 	response, err = suite.server.ListUsers(ctx, empty)
 	if err != nil {
 		panic(err)
@@ -115,6 +128,375 @@ func (suite *UserApiTestSuite) TestDeleteUser() {
 	}
 }
 
+func (suite *UserApiTestSuite) TestRestoreUser() {
+	ctx := suite.ctx
+
+	user := &pbUser.UserRequest{Id: "5253747c-2b8c-40e2-8a70-bab91348a9bd"}
+
+	_, err := suite.server.DeleteUser(ctx, user)
+	if err != nil {
+		panic(err)
+	}
+
+	// the deleted user is hidden but listed as deleted
+	_, err = suite.server.GetUser(ctx, user)
+	assert.NotNil(suite.T(), err)
+
+	deleted, err := suite.server.ListDeletedUsers(ctx, &pbUser.DeletedUserListRequest{})
+	if err != nil {
+		panic(err)
+	}
+
+	if assert.Equal(suite.T(), 1, len(deleted.User)) {
+		assert.Equal(suite.T(), user.Id, deleted.User[0].User.Id)
+	}
+
+	// deleting twice is an error
+	_, err = suite.server.DeleteUser(ctx, user)
+	assert.NotNil(suite.T(), err)
+
+	_, err = suite.server.RestoreUser(ctx, user)
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = suite.server.GetUser(ctx, user)
+	assert.Nil(suite.T(), err)
+
+	// restoring a user that is not deleted is an error
+	_, err = suite.server.RestoreUser(ctx, user)
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *UserApiTestSuite) TestPurgeDeletedUsers() {
+	ctx := suite.ctx
+
+	added, err := suite.server.AddUser(ctx, &pbUser.UserAddRequest{
+		Username: "purge@me.com",
+		FullName: "Purge Me",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = suite.server.DeleteUser(ctx, added)
+	if err != nil {
+		panic(err)
+	}
+
+	// nothing has expired yet
+	purged, err := suite.server.PurgeExpiredUsers(ctx)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(suite.T(), 0, purged)
+
+	addedID := uuid.MustParse(added.Id)
+
+	_, err = suite.db.NewInsert().
+		Model(&model.EmailToken{
+			UserID:    addedID,
+			Purpose:   model.EmailTokenConfirmEmail,
+			ExpiresAt: time.Now().UTC().Add(time.Hour),
+		}).
+		Exec(ctx)
+	if err != nil {
+		panic(err)
+	}
+
+	purged, err = suite.server.PurgeDeletedUsers(ctx, time.Now().UTC().Add(time.Minute))
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(suite.T(), 1, purged)
+
+	// purging removes the user's email tokens too
+	tokens, err := suite.db.NewSelect().
+		Model((*model.EmailToken)(nil)).
+		WhereAllWithDeleted().
+		Where("user_id = ?", addedID).
+		Count(ctx)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(suite.T(), 0, tokens)
+
+	count, err := suite.db.NewSelect().
+		Model((*model.User)(nil)).
+		WhereAllWithDeleted().
+		Where("id = ?", added.Id).
+		Count(ctx)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(suite.T(), 0, count)
+
+	// a purged user can no longer be restored
+	_, err = suite.server.RestoreUser(ctx, added)
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *UserApiTestSuite) TestAnonymizeUser() {
+	ctx := suite.ctx
+
+	added, err := suite.server.AddUser(ctx, &pbUser.UserAddRequest{
+		Username: "forget@me.com",
+		FullName: "Forget Me",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	// transferring groups needs a valid new owner
+	_, err = suite.server.AnonymizeUser(ctx, &pbUser.UserAnonymizeRequest{
+		Id:          added.Id,
+		GroupPolicy: pbUser.UserGroupPolicy_TRANSFER,
+	})
+	assert.NotNil(suite.T(), err)
+
+	_, err = suite.server.AnonymizeUser(ctx, &pbUser.UserAnonymizeRequest{Id: added.Id})
+	if err != nil {
+		panic(err)
+	}
+
+	// the tombstone keeps its id but none of the personal data
+	tombstone, err := suite.server.GetUser(ctx, added)
+	if err != nil {
+		panic(err)
+	}
+
+	id, _ := uuid.Parse(added.Id)
+
+	assert.Equal(suite.T(), server.AnonymizedUsername(id), tombstone.Username)
+	assert.Equal(suite.T(), "", tombstone.FullName)
+
+	// anonymizing twice is an error
+	_, err = suite.server.AnonymizeUser(ctx, &pbUser.UserAnonymizeRequest{Id: added.Id})
+	assert.NotNil(suite.T(), err)
+
+	_, err = suite.db.NewDelete().
+		Model((*model.User)(nil)).
+		WhereAllWithDeleted().
+		Where("id = ?", added.Id).
+		ForceDelete().
+		Exec(ctx)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (suite *UserApiTestSuite) TestAnonymizeDeletedUser() {
+	ctx := suite.ctx
+
+	heir, err := suite.server.AddUser(ctx, &pbUser.UserAddRequest{
+		Username: "heir@user.com",
+		FullName: "Heir",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	groups := make(map[pbUser.UserGroupPolicy]string)
+
+	for policy, username := range map[pbUser.UserGroupPolicy]string{
+		pbUser.UserGroupPolicy_DETACH:   "deleted.detach@user.com",
+		pbUser.UserGroupPolicy_TRANSFER: "deleted.transfer@user.com",
+	} {
+		added, err := suite.server.AddUser(ctx, &pbUser.UserAddRequest{
+			Username: username,
+			FullName: "Deleted User",
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		group, err := suite.server.AddUserGroup(ctx, &pbUser.UserGroupCreateRequest{
+			Id:          added.Id,
+			DisplayName: "Deleted Band " + policy.String(),
+			GroupType:   "band",
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		groups[policy] = group.Id
+
+		if _, err = suite.server.DeleteUser(ctx, added); err != nil {
+			panic(err)
+		}
+
+		_, err = suite.server.AnonymizeUser(ctx, &pbUser.UserAnonymizeRequest{
+			Id:          added.Id,
+			GroupPolicy: policy,
+			TransferTo:  heir.Id,
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// detached groups deleted with their owner are purged
+	count, err := suite.db.NewSelect().
+		Model((*model.UserGroup)(nil)).
+		WhereAllWithDeleted().
+		Where("id = ?", groups[pbUser.UserGroupPolicy_DETACH]).
+		Count(ctx)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(suite.T(), 0, count)
+
+	// transferred ones are restored for their new owner
+	transferred := new(model.UserGroup)
+
+	err = suite.db.NewSelect().
+		Model(transferred).
+		Where("id = ?", groups[pbUser.UserGroupPolicy_TRANSFER]).
+		Scan(ctx)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(suite.T(), heir.Id, transferred.OwnerID.String())
+}
+
+func (suite *UserApiTestSuite) TestUpdateUserVersion() {
+	ctx := suite.ctx
+
+	added, err := suite.server.AddUser(ctx, &pbUser.UserAddRequest{
+		Username: "versioned@user.com",
+		FullName: "Versioned User",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	user, err := suite.server.GetUserRestricted(ctx, &pbUser.UserRequest{Id: added.Id})
+	if err != nil {
+		panic(err)
+	}
+
+	version := user.Version
+	firstName := "Versioned"
+
+	_, err = suite.server.UpdateUser(ctx, &pbUser.UserUpdateRequest{
+		Id:        added.Id,
+		FirstName: &firstName,
+		Version:   &version,
+	})
+	assert.Nil(suite.T(), err)
+
+	// the update bumped the version, so the same version is now stale
+	_, err = suite.server.UpdateUser(ctx, &pbUser.UserUpdateRequest{
+		Id:        added.Id,
+		FirstName: &firstName,
+		Version:   &version,
+	})
+	assert.Equal(suite.T(), codes.Aborted, status.Code(err))
+
+	// as is the same version sent as If-Match through the gateway
+	staleCtx := metadata.NewIncomingContext(ctx, metadata.Pairs("grpcgateway-if-match", server.FormatETag(version)))
+
+	_, err = suite.server.UpdateUser(staleCtx, &pbUser.UserUpdateRequest{
+		Id:        added.Id,
+		FirstName: &firstName,
+	})
+	assert.Equal(suite.T(), codes.Aborted, status.Code(err))
+
+	current := version + 1
+	currentCtx := metadata.NewIncomingContext(ctx, metadata.Pairs("grpcgateway-if-match", server.FormatETag(current)))
+
+	_, err = suite.server.UpdateUser(currentCtx, &pbUser.UserUpdateRequest{
+		Id:        added.Id,
+		FirstName: &firstName,
+	})
+	assert.Nil(suite.T(), err)
+
+	_, err = suite.db.NewDelete().
+		Model((*model.User)(nil)).
+		WhereAllWithDeleted().
+		Where("id = ?", added.Id).
+		ForceDelete().
+		Exec(ctx)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (suite *UserApiTestSuite) TestListUsersPagination() {
+	ctx := suite.ctx
+
+	// Walk the fixture users two at a time, newest first
+	request := &pbUser.UserListRequest{PageSize: 2, OrderBy: "-created_at"}
+
+	seen := map[string]bool{}
+	pages := 0
+
+	for {
+		response, err := suite.server.ListUsers(ctx, request)
+		if err != nil {
+			panic(err)
+		}
+
+		pages++
+
+		assert.LessOrEqual(suite.T(), len(response.User), 2)
+
+		for _, user := range response.User {
+			// no user is returned twice across pages
+			assert.False(suite.T(), seen[user.Id])
+			seen[user.Id] = true
+		}
+
+		if response.NextPageToken == "" {
+			break
+		}
+
+		request.PageToken = response.NextPageToken
+	}
+
+	assert.Equal(suite.T(), 5, len(seen))
+	assert.Equal(suite.T(), 3, pages)
+
+	// A page token is only valid for the sort order it was issued for
+	response, err := suite.server.ListUsers(ctx, &pbUser.UserListRequest{PageSize: 2})
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = suite.server.ListUsers(ctx, &pbUser.UserListRequest{PageSize: 2, OrderBy: "username", PageToken: response.NextPageToken})
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *UserApiTestSuite) TestListUsersFilters() {
+	ctx := suite.ctx
+
+	member := true
+
+	response, err := suite.server.ListUsers(ctx, &pbUser.UserListRequest{Member: &member})
+	if err != nil {
+		panic(err)
+	}
+
+	for _, user := range response.User {
+		assert.True(suite.T(), user.Member)
+	}
+
+	response, err = suite.server.ListUsers(ctx, &pbUser.UserListRequest{RoleId: getIntPointer(int32(model.SuperAdminRole))})
+	if err != nil {
+		panic(err)
+	}
+
+	for _, user := range response.User {
+		assert.Equal(suite.T(), int32(model.SuperAdminRole), user.RoleId)
+	}
+
+	_, err = suite.server.ListUsers(ctx, &pbUser.UserListRequest{CreatedAfter: "yesterday"})
+	assert.NotNil(suite.T(), err)
+
+	_, err = suite.server.ListUsers(ctx, &pbUser.UserListRequest{OrderBy: "password"})
+	assert.NotNil(suite.T(), err)
+}
+
 // func (db *bun.DB, ctx context.Context) RunUserTests() {
 // 	testrun := new(UserApiTestSuite)
 // 	testrun.db = db
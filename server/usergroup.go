@@ -41,6 +41,10 @@ func (s *Server) AddUserGroup(ctx context.Context, usergroup *pbUser.UserGroupCr
 		return nil, errors.New("supplied user_id is not a valid UUID")
 	}
 
+	if err = s.authorizeUser(ctx, s.db, usergroup.Id); err != nil {
+		return nil, err
+	}
+
 	existingGroupCount, _ := s.db.NewSelect().
 		Model((*model.UserGroup)(nil)).
 		Where("owner_id = ?", OwnerUUID).
@@ -238,6 +242,19 @@ func (s *Server) AddUserGroup(ctx context.Context, usergroup *pbUser.UserGroupCr
 // UpdateUser updates a users basic attributes
 func (s *Server) UpdateUserGroup(ctx context.Context, UserGroupUpdateRequest *pbUser.UserGroupUpdateRequest) (*pbUser.Empty, error) {
 
+	version, err := requiredVersion(ctx, UserGroupUpdateRequest.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.authorizeUserGroup(ctx, s.db, UserGroupUpdateRequest.Id); err != nil {
+		return nil, err
+	}
+
+	if err = checkVersion(ctx, s.db, "user_groups", UserGroupUpdateRequest.Id, version); err != nil {
+		return nil, err
+	}
+
 	var updatedUserGroupValues = make(map[string]interface{})
 
 	if UserGroupUpdateRequest.GroupEmail != nil {
@@ -410,7 +427,13 @@ func (s *Server) UpdateUserGroup(ctx context.Context, UserGroupUpdateRequest *pb
 
 	updatedUserGroupValues["updated_at"] = time.Now().UTC()
 
-	rows, err := s.db.NewUpdate().Model(&updatedUserGroupValues).TableExpr("user_groups").Where("id = ?", UserGroupUpdateRequest.Id).Exec(ctx)
+	q := s.db.NewUpdate().Model(&updatedUserGroupValues).TableExpr("user_groups").Where("id = ?", UserGroupUpdateRequest.Id)
+
+	if version != nil {
+		q.Where("version = ?", *version)
+	}
+
+	rows, err := q.Exec(ctx)
 
 	if err != nil {
 		return nil, err
@@ -419,6 +442,10 @@ func (s *Server) UpdateUserGroup(ctx context.Context, UserGroupUpdateRequest *pb
 	number, _ := rows.RowsAffected()
 
 	if number == 0 {
+		// the record may have changed since it was checked
+		if err = checkVersion(ctx, s.db, "user_groups", UserGroupUpdateRequest.Id, version); err != nil {
+			return nil, err
+		}
 		return nil, errors.New("warning: no rows were updated")
 	}
 
@@ -427,6 +454,10 @@ func (s *Server) UpdateUserGroup(ctx context.Context, UserGroupUpdateRequest *pb
 
 // DeleteUser Deletes a user from the DB
 func (s *Server) DeleteUserGroup(ctx context.Context, usergroup *pbUser.UserGroupRequest) (*pbUser.Empty, error) {
+	if err := s.authorizeUserGroup(ctx, s.db, usergroup.Id); err != nil {
+		return nil, err
+	}
+
 	u := new(model.UserGroup)
 
 	_, err := s.db.NewDelete().
@@ -490,21 +521,35 @@ func (s *Server) GetUserGroup(ctx context.Context, usergrouprequest *pbUser.User
 		}
 	}
 
+	followerCount, err := s.followerCount(ctx, usergroup.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	setETag(ctx, usergroup.Version)
+
 	return &pbUser.UserGroupPublicResponse{
-		DisplayName: usergroup.DisplayName,
-		GroupType:   group.Name,
-		ShortBio:    usergroup.ShortBio,
-		Description: usergroup.Description,
-		Links:       usergroupLinks,
-		Avatar:      uuid.UUID.String(usergroup.Avatar),
-		Banner:      uuid.UUID.String(usergroup.Banner),
-		GroupEmail:  usergroup.GroupEmail,
+		DisplayName:   usergroup.DisplayName,
+		GroupType:     group.Name,
+		ShortBio:      usergroup.ShortBio,
+		Description:   usergroup.Description,
+		Links:         usergroupLinks,
+		Avatar:        uuid.UUID.String(usergroup.Avatar),
+		Banner:        uuid.UUID.String(usergroup.Banner),
+		GroupEmail:    usergroup.GroupEmail,
+		FollowerCount: int64(followerCount),
+		Version:       usergroup.Version,
 	}, nil
 }
 
 // ListUsersUserGroups lists all the User Groups owned by the supplied User Id
 func (s *Server) ListUsersUserGroups(ctx context.Context, user *pbUser.UserRequest) (*pbUser.UserGroupListResponse, error) {
 
+	if err := s.authorizeUser(ctx, s.db, user.Id); err != nil {
+		return nil, err
+	}
+
 	var usergroups []model.UserGroup
 	var results pbUser.UserGroupListResponse
 
@@ -538,6 +583,7 @@ func (s *Server) ListUsersUserGroups(ctx context.Context, user *pbUser.UserReque
 		result.GroupEmail = usergroup.GroupEmail
 		result.CreatedAt = usergroup.CreatedAt.UTC().String()
 		result.UpdatedAt = usergroup.UpdatedAt.UTC().String()
+		result.Version = usergroup.Version
 
 		results.Usergroup = append(results.Usergroup, &result)
 	}
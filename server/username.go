@@ -0,0 +1,187 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	uuid "github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/uptrace/bun"
+	"google.golang.org/grpc/codes"
+	grpclog "google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/status"
+
+	"github.com/resonatecoop/user-api-template/model"
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+)
+
+const (
+	// EmailChangeTemplate is the template name handed to the MailSender for
+	// confirming a new email address
+	EmailChangeTemplate = "email-change"
+
+	// EmailChangeNoticeTemplate is the template name handed to the MailSender
+	// for telling the current address about a requested change
+	EmailChangeNoticeTemplate = "email-change-notice"
+)
+
+// uniqueViolation is the postgres error code of a unique constraint violation
+const uniqueViolation = "23505"
+
+// isUniqueViolation reports whether err is a unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
+
+// checkUsernameAvailable returns an AlreadyExists error when another user,
+// deleted or not, has username
+func checkUsernameAvailable(ctx context.Context, db bun.IDB, username string, id string) error {
+	taken, err := db.NewSelect().
+		Model((*model.User)(nil)).
+		WhereAllWithDeleted().
+		Where("username = ?", username).
+		Where("id != ?", id).
+		Exists(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if taken {
+		return status.Errorf(codes.AlreadyExists, "username is already taken")
+	}
+
+	return nil
+}
+
+// sendEmailChange emails a confirmation token to the pending username and a
+// notice to the current one. Failures are logged, the pending username has
+// already been saved and can be requested again.
+func (s *Server) sendEmailChange(ctx context.Context, id string, username string, pendingUsername string) {
+	userID, err := uuid.Parse(id)
+
+	if err == nil {
+		email := model.NewOauthEmail(pendingUsername, "Confirm your new email address", EmailChangeTemplate)
+		err = s.sendEmailToken(ctx, userID, model.EmailTokenChangeEmail, email)
+	}
+
+	if err != nil {
+		grpclog.Errorf("[user-api] sending email change confirmation to user %s failed: %v", id, err)
+	}
+
+	notice := model.NewOauthEmail(username, "Your email address is being changed", EmailChangeNoticeTemplate)
+
+	if err = s.mailer.Send(ctx, notice, map[string]string{"new_username": pendingUsername}); err != nil {
+		grpclog.Errorf("[user-api] sending email change notice to user %s failed: %v", id, err)
+	}
+}
+
+// changeUsername replaces a user's username within tx and records the
+// previous one in the username history
+func changeUsername(ctx context.Context, tx bun.Tx, u *model.User, username string, source string) error {
+	now := time.Now().UTC()
+
+	_, err := tx.NewUpdate().
+		Model((*model.User)(nil)).
+		Set("username = ?", username).
+		Set("pending_username = NULL").
+		Set("email_confirmed = ?", source == model.UsernameChangeConfirmed).
+		Set("updated_at = ?", now).
+		Where("id = ?", u.ID).
+		Exec(ctx)
+
+	if isUniqueViolation(err) {
+		return status.Errorf(codes.AlreadyExists, "username is already taken")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.NewInsert().
+		Model(&model.UsernameChange{
+			ID:          uuid.Must(uuid.NewRandom()),
+			UserID:      u.ID,
+			OldUsername: u.Username,
+			NewUsername: username,
+			Source:      source,
+			ChangedAt:   now,
+		}).
+		Exec(ctx)
+
+	return err
+}
+
+// ConfirmEmailChange redeems an email change token, making the pending
+// username of the user it was issued to their username
+func (s *Server) ConfirmEmailChange(ctx context.Context, req *pbUser.ConfirmEmailRequest) (*pbUser.Empty, error) {
+	err := s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		emailToken, claims, err := s.redeemEmailToken(ctx, tx, req.Token, model.EmailTokenChangeEmail)
+
+		if err != nil {
+			return err
+		}
+
+		u := new(model.User)
+
+		// a later change request replaces the pending username
+		err = tx.NewSelect().
+			Model(u).
+			Where("id = ?", emailToken.UserID).
+			Where("pending_username = ?", claims.Username).
+			For("UPDATE").
+			Scan(ctx)
+
+		if err != nil {
+			return status.Errorf(codes.FailedPrecondition, "token does not match the user's pending email")
+		}
+
+		return changeUsername(ctx, tx, u, claims.Username, model.UsernameChangeConfirmed)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &pbUser.Empty{}, nil
+}
+
+// ListUsernameChanges lists the previous usernames of a user, most recent first
+func (s *Server) ListUsernameChanges(ctx context.Context, req *pbUser.UserRequest) (*pbUser.UsernameChangeListResponse, error) {
+	if err := s.authorizeUser(ctx, s.db, req.Id); err != nil {
+		return nil, err
+	}
+
+	var changes []model.UsernameChange
+
+	err := s.db.NewSelect().
+		Model(&changes).
+		Where("user_id = ?", req.Id).
+		Order("changed_at DESC").
+		Scan(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var results pbUser.UsernameChangeListResponse
+
+	for _, change := range changes {
+		results.Changes = append(results.Changes, &pbUser.UsernameChange{
+			OldUsername: change.OldUsername,
+			NewUsername: change.NewUsername,
+			Source:      change.Source,
+			ChangedAt:   change.ChangedAt.UTC().Format(time.RFC3339),
+		})
+	}
+
+	return &results, nil
+}
+
+// normalizeUsername lower cases a username the way AddUser stores it
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
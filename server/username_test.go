@@ -0,0 +1,90 @@
+package server_test
+
+import (
+	"github.com/resonatecoop/user-api-template/model"
+	"github.com/resonatecoop/user-api-template/server"
+
+	pbUser "github.com/resonatecoop/user-api-template/proto/user"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (suite *UserApiTestSuite) TestEmailChange() {
+	ctx := suite.ctx
+
+	mailer := new(recordingMailSender)
+	srv := server.New(suite.db, suite.cfg, server.WithMailSender(mailer))
+
+	added, err := srv.AddUser(ctx, &pbUser.UserAddRequest{
+		Username: "change@me.com",
+		FullName: "Change Me",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	// the new username can't belong to someone else
+	taken := "test@superuser.com"
+
+	_, err = srv.UpdateUser(ctx, &pbUser.UserUpdateRequest{Id: added.Id, Username: &taken})
+	assert.Equal(suite.T(), codes.AlreadyExists, status.Code(err))
+
+	username := "Changed@Me.com"
+
+	_, err = srv.UpdateUser(ctx, &pbUser.UserUpdateRequest{Id: added.Id, Username: &username})
+	if err != nil {
+		panic(err)
+	}
+
+	user, err := srv.GetUserRestricted(ctx, &pbUser.UserRequest{Id: added.Id})
+	if err != nil {
+		panic(err)
+	}
+
+	// the username is kept until the new address is confirmed
+	assert.Equal(suite.T(), "change@me.com", user.Username)
+	assert.Equal(suite.T(), "changed@me.com", user.PendingUsername)
+
+	// registration confirmation, then change confirmation and notice
+	if !assert.Equal(suite.T(), 3, len(mailer.sent)) {
+		return
+	}
+	assert.Equal(suite.T(), "changed@me.com", mailer.sent[2]["new_username"])
+
+	// an email confirmation token can't change the username
+	_, err = srv.ConfirmEmailChange(ctx, &pbUser.ConfirmEmailRequest{Token: mailer.sent[0]["token"]})
+	assert.NotNil(suite.T(), err)
+
+	_, err = srv.ConfirmEmailChange(ctx, &pbUser.ConfirmEmailRequest{Token: mailer.sent[1]["token"]})
+	if err != nil {
+		panic(err)
+	}
+
+	user, err = srv.GetUserRestricted(ctx, &pbUser.UserRequest{Id: added.Id})
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(suite.T(), "changed@me.com", user.Username)
+	assert.Equal(suite.T(), "", user.PendingUsername)
+	assert.True(suite.T(), user.EmailConfirmed)
+
+	history, err := srv.ListUsernameChanges(ctx, &pbUser.UserRequest{Id: added.Id})
+	if err != nil {
+		panic(err)
+	}
+	if assert.Equal(suite.T(), 1, len(history.Changes)) {
+		assert.Equal(suite.T(), "change@me.com", history.Changes[0].OldUsername)
+		assert.Equal(suite.T(), model.UsernameChangeConfirmed, history.Changes[0].Source)
+	}
+
+	_, err = suite.db.NewDelete().
+		Model((*model.User)(nil)).
+		WhereAllWithDeleted().
+		Where("id = ?", added.Id).
+		ForceDelete().
+		Exec(ctx)
+	if err != nil {
+		panic(err)
+	}
+}